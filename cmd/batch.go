@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	net_url "net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zuiwuchang/mget/download"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+func runBatch(input, dir string, jobs int, limitRate utils.Size, yes bool, events string,
+	newOptions func(url, output string, header []string) (*download.Options, error),
+) {
+	inputs, e := readInput(input)
+	if e != nil {
+		log.Fatalln(e)
+	} else if len(inputs) == 0 {
+		log.Fatalln(`no url found in input:`, input)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var (
+		downloaders = make([]*download.Downloader, 0, len(inputs))
+		exists      []string
+		// files with the same proxy and tls options share a client, the options may differ by the host rules of the config file
+		clients = make(map[string]*http.Client)
+	)
+	for _, input := range inputs {
+		opts, e := newOptions(input.URL, input.Output, input.Header)
+		if e != nil {
+			log.Fatalln(input.URL, e)
+		}
+		opts.Dir = dir
+		opts.Headless = true
+		key := fmt.Sprint(opts.Proxy, ` `, opts.Insecure, ` `, &opts.TLS)
+		if opts.TLS.ServerName != `` {
+			// the server name is only sent to the host of the url creating the client
+			if u, e := net_url.Parse(input.URL); e == nil {
+				key += ` ` + u.Hostname()
+			}
+		}
+		client, shared := clients[key]
+		opts.Client = client
+		d, e := download.New(ctx, opts)
+		if e != nil {
+			log.Fatalln(input.URL, e)
+		}
+		if !shared {
+			client, e = d.Client()
+			if e != nil {
+				log.Fatalln(e)
+			}
+			clients[key] = client
+		}
+		found, e := d.Exists()
+		if e != nil {
+			log.Fatalln(e)
+		} else if found {
+			exists = append(exists, d.Output())
+		}
+		downloaders = append(downloaders, d)
+	}
+	out := humanOutput(events)
+	downloaders[0].Fprintln(out)
+	for i, d := range downloaders {
+		fmt.Fprintln(out, inputs[i].URL, `->`, d.Output())
+	}
+	if !yes {
+		val := readBool(bufio.NewReader(os.Stdin), out, fmt.Sprintf(`Are you sure you want to start downloading %v files <y/n>`, len(downloaders)))
+		if !val {
+			return
+		}
+		if len(exists) != 0 {
+			for _, output := range exists {
+				fmt.Fprintln(out, `File already exists:`, output)
+			}
+			val = readBool(bufio.NewReader(os.Stdin), out, `Are you sure you want to overwrite the existing files <y/n>`)
+			if !val {
+				return
+			}
+		}
+	}
+
+	var m sync.Mutex
+	e = download.Batch(ctx, downloaders, jobs, limitRate, events, func(d *download.Downloader, used time.Duration, e error) {
+		m.Lock()
+		defer m.Unlock()
+		if e != nil {
+			fmt.Fprintln(os.Stderr, `failed:`, d.Output(), e)
+		} else {
+			fmt.Fprintln(out, `success:`, d.Output(), used)
+		}
+	})
+	if e != nil {
+		log.Fatalln(e)
+	}
+}
+func readInput(input string) (inputs []metadata.Input, e error) {
+	var r io.Reader
+	if input == `-` {
+		r = os.Stdin
+	} else {
+		var f *os.File
+		f, e = os.Open(input)
+		if e != nil {
+			return
+		}
+		defer f.Close()
+		r = f
+	}
+	return metadata.ReadInput(r)
+}
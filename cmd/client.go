@@ -0,0 +1,203 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zuiwuchang/mget/cmd/internal/daemon"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+func init() {
+	var (
+		address  string
+		url      string
+		output   string
+		headers  []string
+		worker   int
+		priority int
+		yes      bool
+	)
+	cmd := &cobra.Command{
+		Use:     `add`,
+		Short:   `add a download job to the daemon`,
+		Example: `mget add -u http://127.0.0.1/tools/source.exe -o a.exe`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if output != `` {
+				// the daemon may run in another directory
+				var e error
+				output, e = filepath.Abs(output)
+				if e != nil {
+					log.Fatalln(e)
+				}
+			}
+			job, e := daemon.NewClient(address).Add(context.Background(), &daemon.AddRequest{
+				URL:       url,
+				Output:    output,
+				Header:    headers,
+				Worker:    worker,
+				Priority:  priority,
+				Overwrite: yes,
+			})
+			if e != nil {
+				log.Fatalln(e)
+			}
+			fmt.Println(job.ID, job.URL, `->`, job.Output)
+		},
+	}
+	daemonFlag(cmd, &address)
+	flags := cmd.Flags()
+	flags.StringVarP(&url,
+		`url`, `u`,
+		``,
+		`http download address`,
+	)
+	flags.StringVarP(&output,
+		`output`, `o`,
+		``,
+		`download target output file path`,
+	)
+	flags.StringSliceVarP(&headers,
+		`Header`, `H`,
+		[]string{},
+		`http request header key: value`,
+	)
+	flags.IntVarP(&worker,
+		`worker`, `w`,
+		0,
+		`number of workers performing downloads, 0 is the default of the daemon`,
+	)
+	flags.IntVar(&priority,
+		`priority`,
+		0,
+		`jobs with a higher priority are started first`,
+	)
+	flags.BoolVarP(&yes,
+		`yes`, `y`,
+		false,
+		`overwrite the existing file`,
+	)
+	rootCmd.AddCommand(cmd)
+
+	rootCmd.AddCommand(lsCommand())
+	rootCmd.AddCommand(jobCommand(`pause`, `pause jobs, the downloaded data is kept to resume`, func(c *daemon.Client, id int64) error {
+		return c.Pause(context.Background(), id)
+	}))
+	rootCmd.AddCommand(jobCommand(`resume`, `resume paused or failed jobs`, func(c *daemon.Client, id int64) error {
+		return c.Resume(context.Background(), id)
+	}))
+	rootCmd.AddCommand(jobCommand(`rm`, `cancel and remove jobs`, func(c *daemon.Client, id int64) error {
+		return c.Remove(context.Background(), id)
+	}))
+	rootCmd.AddCommand(valueCommand(`prio`, `set the priority of a job`, func(c *daemon.Client, id int64, n int) error {
+		return c.SetPriority(context.Background(), id, n)
+	}))
+	rootCmd.AddCommand(valueCommand(`increase`, `increase n workers of a job`, func(c *daemon.Client, id int64, n int) error {
+		return c.Increase(context.Background(), id, n)
+	}))
+	rootCmd.AddCommand(valueCommand(`reduce`, `reduce n workers of a job`, func(c *daemon.Client, id int64, n int) error {
+		return c.Reduce(context.Background(), id, n)
+	}))
+}
+func daemonFlag(cmd *cobra.Command, address *string) {
+	cmd.Flags().StringVarP(address,
+		`daemon`, `d`,
+		daemon.DefaultAddress(),
+		`address of the daemon, a unix socket path or host:port`,
+	)
+}
+func lsCommand() *cobra.Command {
+	var address string
+	cmd := &cobra.Command{
+		Use:   `ls`,
+		Short: `list jobs of the daemon`,
+		Run: func(cmd *cobra.Command, args []string) {
+			jobs, e := daemon.NewClient(address).List(context.Background())
+			if e != nil {
+				log.Fatalln(e)
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tPRIO\tSTATE\tWORKER\tPROGRESS\tSPEED\tETA\tOUTPUT")
+			for _, job := range jobs {
+				progress := utils.Size(job.Downloaded).String()
+				if job.Size > 0 {
+					progress = fmt.Sprintf(`%s/%s`, progress, utils.Size(job.Size))
+				}
+				var speed, eta, worker string
+				if job.Speed != 0 {
+					speed = utils.Size(job.Speed).String() + `/s`
+				}
+				if job.ETA != 0 {
+					eta = (time.Duration(job.ETA) * time.Second).String()
+				}
+				if job.Worker != 0 {
+					worker = strconv.Itoa(job.Worker)
+				}
+				state := job.State
+				if job.Error != `` {
+					state += `: ` + job.Error
+				}
+				fmt.Fprintf(w, "%v\t%v\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					job.ID, job.Priority, state, worker, progress, speed, eta, job.Output,
+				)
+			}
+			w.Flush()
+		},
+	}
+	daemonFlag(cmd, &address)
+	return cmd
+}
+func jobCommand(use, short string, f func(c *daemon.Client, id int64) error) *cobra.Command {
+	var address string
+	cmd := &cobra.Command{
+		Use:   use + ` id...`,
+		Short: short,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			c := daemon.NewClient(address)
+			for _, arg := range args {
+				id, e := strconv.ParseInt(arg, 10, 64)
+				if e != nil {
+					log.Fatalln(e)
+				}
+				e = f(c, id)
+				if e != nil {
+					log.Fatalln(id, e)
+				}
+			}
+		},
+	}
+	daemonFlag(cmd, &address)
+	return cmd
+}
+func valueCommand(use, short string, f func(c *daemon.Client, id int64, n int) error) *cobra.Command {
+	var address string
+	cmd := &cobra.Command{
+		Use:   use + ` id n`,
+		Short: short,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			id, e := strconv.ParseInt(args[0], 10, 64)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			n, e := strconv.Atoi(args[1])
+			if e != nil {
+				log.Fatalln(e)
+			}
+			e = f(daemon.NewClient(address), id, n)
+			if e != nil {
+				log.Fatalln(e)
+			}
+		},
+	}
+	daemonFlag(cmd, &address)
+	return cmd
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/zuiwuchang/mget/cmd/internal/config"
+	"github.com/zuiwuchang/mget/download"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// options are the flags which can be set by the config file
+type options struct {
+	proxy       string
+	agent       string
+	headers     []string
+	cookies     []string
+	insecure    bool
+	tls         download.TLS
+	worker      int
+	blockStr    string
+	store       string
+	tempDir     string
+	stateDir    string
+	preallocate bool
+}
+
+// profile resolves the options of a url from the config file, the flags set on the command line are not overridden
+type profile struct {
+	flags  *pflag.FlagSet
+	config *config.Config
+	name   string
+}
+
+func configFlags(cmd *cobra.Command, filename, name *string) {
+	flags := cmd.Flags()
+	flags.StringVar(filename,
+		`config`,
+		config.DefaultFilename(),
+		`config file of the default options, profiles and host rules`,
+	)
+	flags.StringVar(name,
+		`profile`,
+		``,
+		`use the options of the named profile in the config file`,
+	)
+}
+func tlsFlags(cmd *cobra.Command, t *download.TLS) {
+	flags := cmd.Flags()
+	flags.StringVar(&t.CACert,
+		`cacert`,
+		``,
+		`pem file of the CA certificates used to verify the servers instead of the system CAs`,
+	)
+	flags.StringVar(&t.Cert,
+		`cert`,
+		``,
+		`pem file of the client certificate for mutual tls`,
+	)
+	flags.StringVar(&t.Key,
+		`key`,
+		``,
+		`pem file of the private key of the client certificate (default is the cert file)`,
+	)
+	flags.StringVar(&t.MinVersion,
+		`tls-min`,
+		``,
+		`min tls version [1.0 1.1 1.2 1.3]`,
+	)
+	flags.StringVar(&t.ServerName,
+		`sni`,
+		``,
+		`server name sent in tls SNI and verified instead of the host of the url, mirrors and redirects use their own host`,
+	)
+	flags.StringSliceVar(&t.Pin,
+		`pin`,
+		nil,
+		`sha256//base64 of the public key of the server certificate, the connection fails if no pin is matched`,
+	)
+	flags.StringVar(&t.ProxyCACert,
+		`proxy-cacert`,
+		``,
+		`pem file of the CA certificates used to verify the https proxy instead of the system CAs`,
+	)
+	flags.BoolVar(&t.ProxyInsecure,
+		`proxy-insecure`,
+		false,
+		`allow insecure connections to the https proxy`,
+	)
+}
+func loadProfile(cmd *cobra.Command, filename, name string) (p *profile, e error) {
+	flags := cmd.Flags()
+	c, e := config.Load(filename, flags.Changed(`config`))
+	if e != nil {
+		return
+	}
+	p = &profile{
+		flags:  flags,
+		config: c,
+		name:   name,
+	}
+	// check the profile exists
+	_, e = c.Resolve(name, ``)
+	return
+}
+func (o *options) apply(opts *download.Options) (e error) {
+	block, e := utils.ParseSize(o.blockStr)
+	if e != nil {
+		return
+	}
+	opts.Proxy = o.proxy
+	opts.UserAgent = o.agent
+	opts.Header = o.headers
+	opts.Cookie = o.cookies
+	opts.Insecure = o.insecure
+	opts.TLS = o.tls
+	opts.Worker = o.worker
+	opts.Block = block
+	opts.Store = o.store
+	opts.TempDir = o.tempDir
+	opts.StateDir = o.stateDir
+	opts.Preallocate = o.preallocate
+	return
+}
+func (p *profile) resolve(url string, flag options) (o options, e error) {
+	c, e := p.config.Resolve(p.name, url)
+	if e != nil {
+		return
+	}
+	o = flag
+	if c.Proxy != `` && !p.flags.Changed(`proxy`) {
+		o.proxy = c.Proxy
+	}
+	if c.Agent != `` && !p.flags.Changed(`agent`) {
+		o.agent = c.Agent
+	}
+	o.headers = config.MergeHeader(c.Header, flag.headers)
+	o.cookies = append(c.Cookie, flag.cookies...)
+	if c.Insecure != nil && !p.flags.Changed(`insecure`) {
+		o.insecure = *c.Insecure
+	}
+	if c.CACert != `` && !p.flags.Changed(`cacert`) {
+		o.tls.CACert = c.CACert
+	}
+	if c.Cert != `` && !p.flags.Changed(`cert`) {
+		o.tls.Cert = c.Cert
+		if !p.flags.Changed(`key`) {
+			o.tls.Key = c.Key
+		}
+	} else if c.Key != `` && !p.flags.Changed(`key`) {
+		o.tls.Key = c.Key
+	}
+	if c.TLSMin != `` && !p.flags.Changed(`tls-min`) {
+		o.tls.MinVersion = c.TLSMin
+	}
+	if c.SNI != `` && !p.flags.Changed(`sni`) {
+		o.tls.ServerName = c.SNI
+	}
+	if len(c.Pin) != 0 && !p.flags.Changed(`pin`) {
+		o.tls.Pin = c.Pin
+	}
+	if c.ProxyCACert != `` && !p.flags.Changed(`proxy-cacert`) {
+		o.tls.ProxyCACert = c.ProxyCACert
+	}
+	if c.ProxyInsecure != nil && !p.flags.Changed(`proxy-insecure`) {
+		o.tls.ProxyInsecure = *c.ProxyInsecure
+	}
+	e = o.tls.Check()
+	if e != nil {
+		return
+	}
+	if c.Worker != 0 && !p.flags.Changed(`worker`) {
+		o.worker = c.Worker
+	}
+	if c.Block != `` && !p.flags.Changed(`block size`) {
+		o.blockStr = c.Block
+	}
+	if c.Store != `` && !p.flags.Changed(`store`) {
+		o.store = c.Store
+	}
+	if c.TempDir != `` && !p.flags.Changed(`temp-dir`) {
+		o.tempDir = c.TempDir
+	}
+	if c.StateDir != `` && !p.flags.Changed(`state-dir`) {
+		o.stateDir = c.StateDir
+	}
+	if c.Preallocate != nil && !p.flags.Changed(`preallocate`) {
+		o.preallocate = *c.Preallocate
+	}
+	return
+}
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zuiwuchang/mget/cmd/internal/daemon"
+	"github.com/zuiwuchang/mget/download"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+func init() {
+	var (
+		listen       string
+		queue        string
+		jobs         int
+		proxy        string
+		agent        string
+		headers      []string
+		cookies      []string
+		insecure     bool
+		worker       int
+		blockStr     string
+		store        string
+		tempDir      string
+		stateDir     string
+		preallocate  bool
+		verify       bool
+		retry        int
+		retryWait    time.Duration
+		retryMaxWait time.Duration
+		limitRate    string
+		limitWorker  string
+		restart      bool
+		mismatch     string
+		autoWorker   bool
+		configFile   string
+		profileName  string
+		tlsOptions   download.TLS
+		transport    download.Transport
+		stallTimeout time.Duration
+	)
+	cmd := &cobra.Command{
+		Use:   `daemon`,
+		Short: `run a daemon downloading the queued jobs, jobs are controlled by add ls pause resume rm prio`,
+		Example: `mget daemon
+mget daemon -l 127.0.0.1:9000 -j 2 -q ~/.mget-queue.json`,
+		Run: func(cmd *cobra.Command, args []string) {
+			e := download.CheckMismatch(mismatch)
+			if e != nil {
+				log.Fatalln(e)
+			} else if mismatch == download.MismatchAsk {
+				log.Fatalln(`mismatch ask is not supported by daemon`)
+			}
+			p, e := loadProfile(cmd, configFile, profileName)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			flag := options{
+				proxy:       proxy,
+				agent:       agent,
+				headers:     headers,
+				cookies:     cookies,
+				insecure:    insecure,
+				tls:         tlsOptions,
+				worker:      worker,
+				blockStr:    blockStr,
+				store:       store,
+				tempDir:     tempDir,
+				stateDir:    stateDir,
+				preallocate: preallocate,
+			}
+			rate, e := utils.ParseSize(limitRate)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			rateWorker, e := utils.ParseSize(limitWorker)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			d, e := daemon.New(jobs, utils.NewLimiter(int64(rate)), queue, func(url, output string, header []string, n int) (opts *download.Options, e error) {
+				o, e := p.resolve(url, flag)
+				if e != nil {
+					return
+				}
+				opts = download.NewOptions(url)
+				opts.Output = output
+				e = o.apply(opts)
+				if e != nil {
+					return
+				}
+				if n > 0 {
+					opts.Worker = n
+				}
+				opts.Header = append(header, opts.Header...)
+				opts.Transport, opts.StallTimeout = transport, stallTimeout
+				opts.Verify = verify
+				opts.Retry, opts.RetryWait, opts.RetryMaxWait = retry, retryWait, retryMaxWait
+				opts.LimitRateWorker = rateWorker
+				opts.RestartChanged = restart
+				opts.AutoWorker = autoWorker
+				opts.Mismatch = mismatch
+				return
+			})
+			if e != nil {
+				log.Fatalln(e)
+			}
+			l, e := daemon.Listen(listen)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			download.SetLogOutput(os.Stderr)
+			log.Println(`daemon listen on`, l.Addr())
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			e = d.Serve(ctx, l)
+			if e != nil {
+				log.Fatalln(e)
+			}
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&listen,
+		`listen`, `l`,
+		daemon.DefaultAddress(),
+		`listen address, a unix socket path or a loopback host:port`,
+	)
+	flags.StringVarP(&queue,
+		`queue`, `q`,
+		``,
+		`save the queue to the file and load it on the next start`,
+	)
+	flags.IntVarP(&jobs,
+		`jobs`, `j`,
+		1,
+		`number of jobs downloaded at the same time`,
+	)
+	flags.BoolVar(&verify,
+		`verify`,
+		false,
+		`verify the hash of finished blocks when resuming and download again the blocks not matched`,
+	)
+	flags.IntVar(&retry,
+		`retry`,
+		5,
+		`max retries of a failed block request before the mirror is dropped or the download stops`,
+	)
+	flags.DurationVar(&retryWait,
+		`retry-wait`,
+		time.Second,
+		`wait before the first retry, it doubles for every retry`,
+	)
+	flags.DurationVar(&retryMaxWait,
+		`retry-max-wait`,
+		time.Minute,
+		`max wait between retries`,
+	)
+	flags.StringVar(&limitRate,
+		`limit-rate`,
+		`0`,
+		`limit the total download rate per second of all jobs [g m k b], 0 is unlimited`,
+	)
+	flags.StringVar(&limitWorker,
+		`limit-rate-per-worker`,
+		`0`,
+		`limit the download rate per second of every worker [g m k b], 0 is unlimited`,
+	)
+	flags.BoolVar(&restart,
+		`restart-changed`,
+		false,
+		`download again from scratch if the file changed on the server, otherwise stop the download`,
+	)
+	flags.StringVar(&mismatch,
+		`mismatch`,
+		download.MismatchAbort,
+		`what to do if the downloaded data does not match when resuming [restart keep-block abort]`,
+	)
+	flags.StringVarP(&proxy,
+		`proxy`, `p`,
+		``,
+		`proxy url [http https socks5 socks5h socks4 socks4a]://[user:password@]host:port, if not set http_proxy https_proxy and all_proxy are used, hosts in no_proxy are always connected directly`,
+	)
+	flags.StringSliceVarP(&headers,
+		`Header`, `H`,
+		[]string{},
+		`http request header of every job key: value`,
+	)
+	flags.StringVarP(&agent,
+		`agent`, `a`,
+		``,
+		`http header User-Agent (default `+download.DefaultUserAgent+`)`,
+	)
+	flags.StringSliceVarP(&cookies,
+		`cookie`, `c`,
+		[]string{},
+		`http request cookie of every job`,
+	)
+	flags.IntVarP(&worker,
+		`worker`, `w`,
+		runtime.NumCPU(),
+		`default number of workers of a job`,
+	)
+	flags.BoolVar(&autoWorker,
+		`auto-worker`,
+		false,
+		`add workers while the throughput keeps rising and remove them when they stop helping or the server returns 429 503, worker is the initial number`,
+	)
+	flags.StringVarP(&blockStr,
+		`block size`, `b`,
+		`5m`,
+		`download block size for each worker [g m k b]`,
+	)
+	flags.StringVar(&store,
+		`store`,
+		download.StoreBolt,
+		`storage of the resume state [bolt journal json memory], journal and json do not need mmap and file locking, memory cannot be resumed`,
+	)
+	flags.StringVar(&tempDir,
+		`temp-dir`,
+		``,
+		`dir of the temp file while downloading (default is beside the output), the finished file is copied if the dir is on another file system`,
+	)
+	flags.StringVar(&stateDir,
+		`state-dir`,
+		``,
+		`dir of the resume state (default is beside the output)`,
+	)
+	flags.BoolVar(&preallocate,
+		`preallocate`,
+		false,
+		`allocate the whole file on the disk before downloading so the disk cannot fill up while downloading, only supported on linux`,
+	)
+	flags.BoolVarP(&insecure,
+		`insecure`, `k`,
+		false,
+		`allow insecure server connections when using SSL`,
+	)
+	tlsFlags(cmd, &tlsOptions)
+	transportFlags(cmd, &transport, &stallTimeout)
+	configFlags(cmd, &configFile, &profileName)
+	rootCmd.AddCommand(cmd)
+}
@@ -7,17 +7,17 @@ import (
 	"log"
 	"os"
 	"runtime"
-	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
-	"github.com/zuiwuchang/mget/cmd/internal/get"
-	"github.com/zuiwuchang/mget/cmd/internal/metadata"
+	"github.com/zuiwuchang/mget/cmd/internal/view"
+	"github.com/zuiwuchang/mget/download"
+	"github.com/zuiwuchang/mget/utils"
 )
 
 func init() {
 	var (
-		url           string
+		urls          []string
 		output        string
 		proxy         string
 		agent         string
@@ -25,92 +25,252 @@ func init() {
 		headers       []string
 		cookies       []string
 		blockStr      string
+		store         string
+		tempDir       string
+		stateDir      string
+		preallocate   bool
 		worker        int
 		yes, insecure bool
 		ascii         bool
+		headless      bool
+		events        string
+		input         string
+		jobs          int
+		sum, sumURL   string
+		verify        bool
+		retry         int
+		retryWait     time.Duration
+		retryMaxWait  time.Duration
+		limitRate     string
+		limitWorker   string
+		restart       bool
+		mismatch      string
+		autoWorker    bool
+		configFile    string
+		profileName   string
+		tlsOptions    download.TLS
+		transport     download.Transport
+		stallTimeout  time.Duration
 	)
 	cmd := &cobra.Command{
 		Use:   `get`,
 		Short: `http get download file`,
 		Example: `mget get -u http://127.0.0.1/tools/source.exe
-mget get -u http://127.0.0.1/tools/source.exe -o a.exe`,
+mget get -u http://127.0.0.1/tools/source.exe -o a.exe
+mget get -u http://127.0.0.1/tools/source.exe -y --headless
+mget get -i urls.txt -o downloads -j 4
+mget get -u http://127.0.0.1/tools/source.exe -u http://mirror.local/tools/source.exe`,
 		Run: func(cmd *cobra.Command, args []string) {
-			if proxy == `` {
-				env := []string{
-					`socket_proxy`,
-					`SOCKET_proxy`,
-					`http_proxy`,
-					`HTTP_PROXY`,
+			e := download.CheckMismatch(mismatch)
+			if e != nil {
+				log.Fatalln(e)
+			} else if !yes && !isTerminal(os.Stdin) {
+				log.Fatalln(`stdin is not a terminal, use -y to download without confirmation`)
+			}
+			p, e := loadProfile(cmd, configFile, profileName)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			flag := options{
+				proxy:       proxy,
+				agent:       agent,
+				headers:     headers,
+				cookies:     cookies,
+				insecure:    insecure,
+				tls:         tlsOptions,
+				worker:      worker,
+				blockStr:    blockStr,
+				store:       store,
+				tempDir:     tempDir,
+				stateDir:    stateDir,
+				preallocate: preallocate,
+			}
+			rate, e := utils.ParseSize(limitRate)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			rateWorker, e := utils.ParseSize(limitWorker)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			newOptions := func(url, output string, header []string) (opts *download.Options, e error) {
+				o, e := p.resolve(url, flag)
+				if e != nil {
+					return
+				}
+				opts = download.NewOptions(url)
+				opts.Output = output
+				e = o.apply(opts)
+				if e != nil {
+					return
 				}
-				for _, k := range env {
-					v := os.Getenv(k)
-					if v == `` {
-						continue
+				opts.Header = append(header, opts.Header...)
+				opts.Head = head
+				opts.Transport, opts.StallTimeout = transport, stallTimeout
+				opts.Verify = verify
+				opts.Retry, opts.RetryWait, opts.RetryMaxWait = retry, retryWait, retryMaxWait
+				opts.LimitRate, opts.LimitRateWorker = rate, rateWorker
+				opts.RestartChanged = restart
+				opts.AutoWorker = autoWorker
+				opts.Mismatch = mismatch
+				return
+			}
+			if input != `` {
+				if len(urls) != 0 {
+					log.Fatalln(`url and input cannot be used together`)
+				} else if sum != `` || sumURL != `` {
+					log.Fatalln(`checksum and input cannot be used together`)
+				}
+				runBatch(input, output, jobs, rate, yes, events, func(url, output string, header []string) (*download.Options, error) {
+					opts, e := newOptions(url, output, header)
+					if e != nil {
+						return nil, e
 					}
-					k = strings.ToLower(k)
-					if strings.HasPrefix(k, `http`) {
-						if !strings.HasPrefix(v, `http://`) && !strings.HasPrefix(v, `https://`) {
-							continue
-						}
-					} else {
-						if !strings.HasPrefix(v, `socks5://`) {
-							continue
-						}
+					if opts.Mismatch == download.MismatchAsk {
+						opts.Mismatch = download.MismatchAbort
 					}
-					proxy = v
-					break
-				}
+					return opts, nil
+				})
+				return
+			}
+			var url string
+			if len(urls) != 0 {
+				url = urls[0]
+			}
+			opts, e := newOptions(url, output, nil)
+			if e != nil {
+				log.Fatalln(e)
+			}
+			if len(urls) > 1 {
+				opts.Mirrors = urls[1:]
 			}
-			conf, e := metadata.NewConfigure(url, output, proxy,
-				agent, head, headers, cookies, insecure,
-				worker, blockStr,
-			)
+			opts.Headless = headless || !isTerminal(os.Stdout)
+			if events == `-` && !opts.Headless {
+				log.Fatalln(`events cannot be written to stdout with the terminal ui, use --headless`)
+			}
+			opts.Events = events
+			opts.Checksum, opts.ChecksumURL = sum, sumURL
+			d, e := download.New(context.Background(), opts)
 			if e != nil {
 				log.Fatalln(e)
 			}
-			conf.ASCII = ascii
-			conf.Println()
+			if !opts.Headless {
+				d.SetUI(view.New(viewRely{
+					Downloader: d,
+					ascii:      ascii,
+				}))
+			}
+			out := humanOutput(events)
+			d.Fprintln(out)
 			if !yes {
-				val := readBool(bufio.NewReader(os.Stdin), `Are you sure you want to start downloading <y/n>`)
+				val := readBool(bufio.NewReader(os.Stdin), out, `Are you sure you want to start downloading <y/n>`)
 				if !val {
 					return
 				}
 			}
-			exists, e := conf.Exists()
+			exists, e := d.Exists()
 			if e != nil {
 				log.Fatalln(e)
 			}
 			if exists && !yes {
-				fmt.Println(`File already exists:`, conf.Output)
-				val := readBool(bufio.NewReader(os.Stdin), `Are you sure you want to overwrite the existing file <y/n>`)
+				fmt.Fprintln(out, `File already exists:`, d.Output())
+				val := readBool(bufio.NewReader(os.Stdin), out, `Are you sure you want to overwrite the existing file <y/n>`)
 				if !val {
 					return
 				}
 			}
 
+			if mismatch == download.MismatchAsk {
+				if yes || !isTerminal(os.Stdin) {
+					d.SetMismatch(download.MismatchAbort)
+				} else {
+					d.SetMismatch(askMismatch(d, out))
+				}
+			}
+
 			last := time.Now()
-			e = get.NewManager(context.Background(), conf).Serve()
+			e = d.Serve()
 			if e != nil {
 				log.Fatalln(e)
 			}
-			fmt.Println(`success:`, conf.Output, time.Since(last))
+			fmt.Fprintln(out, `success:`, d.Output(), time.Since(last))
 		},
 	}
 	flags := cmd.Flags()
-	flags.StringVarP(&url,
+	flags.StringArrayVarP(&urls,
 		`url`, `u`,
-		``,
-		`http download address`,
+		nil,
+		`http download address, repeat it to download the same file from several mirrors`,
 	)
 	flags.StringVarP(&output,
 		`output`, `o`,
 		``,
 		`download target output file path`,
 	)
+	flags.StringVarP(&input,
+		`input`, `i`,
+		``,
+		`download every url listed in the file, - for stdin, output is used as the output directory`,
+	)
+	flags.IntVarP(&jobs,
+		`jobs`, `j`,
+		1,
+		`number of files downloaded at the same time when using input, workers are shared by all files`,
+	)
+	flags.StringVar(&sum,
+		`checksum`,
+		``,
+		`verify the downloaded file, algorithm:hex [md5 sha1 sha256 sha512], only the algorithm if checksum-url is used`,
+	)
+	flags.StringVar(&sumURL,
+		`checksum-url`,
+		``,
+		`read the expected checksum from a sidecar url such as <url>.sha256 or SHA256SUMS`,
+	)
+	flags.BoolVar(&verify,
+		`verify`,
+		false,
+		`verify the hash of finished blocks when resuming and download again the blocks not matched`,
+	)
+	flags.IntVar(&retry,
+		`retry`,
+		5,
+		`max retries of a failed block request before the mirror is dropped or the download stops`,
+	)
+	flags.DurationVar(&retryWait,
+		`retry-wait`,
+		time.Second,
+		`wait before the first retry, it doubles for every retry`,
+	)
+	flags.DurationVar(&retryMaxWait,
+		`retry-max-wait`,
+		time.Minute,
+		`max wait between retries`,
+	)
+	flags.StringVar(&limitRate,
+		`limit-rate`,
+		`0`,
+		`limit the total download rate per second [g m k b], 0 is unlimited`,
+	)
+	flags.StringVar(&limitWorker,
+		`limit-rate-per-worker`,
+		`0`,
+		`limit the download rate per second of every worker [g m k b], 0 is unlimited`,
+	)
+	flags.BoolVar(&restart,
+		`restart-changed`,
+		false,
+		`download again from scratch if the file changed on the server, otherwise stop the download`,
+	)
+	flags.StringVar(&mismatch,
+		`mismatch`,
+		download.MismatchAsk,
+		`what to do if the downloaded data does not match when resuming [ask restart keep-block abort], ask is abort if input is used or the question is answered by yes`,
+	)
 	flags.StringVarP(&proxy,
 		`proxy`, `p`,
 		``,
-		`socks5://xxx http://xxx`,
+		`proxy url [http https socks5 socks5h socks4 socks4a]://[user:password@]host:port, if not set http_proxy https_proxy and all_proxy are used, hosts in no_proxy are always connected directly`,
 	)
 	flags.StringSliceVarP(&headers,
 		`Header`, `H`,
@@ -120,7 +280,7 @@ mget get -u http://127.0.0.1/tools/source.exe -o a.exe`,
 	flags.StringVarP(&agent,
 		`agent`, `a`,
 		``,
-		`http header User-Agent (default `+metadata.UserAgent+`)`,
+		`http header User-Agent (default `+download.DefaultUserAgent+`)`,
 	)
 	flags.StringSliceVarP(&cookies,
 		`cookie`, `c`,
@@ -132,11 +292,36 @@ mget get -u http://127.0.0.1/tools/source.exe -o a.exe`,
 		runtime.NumCPU(),
 		`number of workers performing downloads`,
 	)
+	flags.BoolVar(&autoWorker,
+		`auto-worker`,
+		false,
+		`add workers while the throughput keeps rising and remove them when they stop helping or the server returns 429 503, worker is the initial number`,
+	)
 	flags.StringVarP(&blockStr,
 		`block size`, `b`,
 		`5m`,
 		`download block size for each worker [g m k b]`,
 	)
+	flags.StringVar(&store,
+		`store`,
+		download.StoreBolt,
+		`storage of the resume state [bolt journal json memory], journal and json do not need mmap and file locking, memory cannot be resumed`,
+	)
+	flags.StringVar(&tempDir,
+		`temp-dir`,
+		``,
+		`dir of the temp file while downloading (default is beside the output), the finished file is copied if the dir is on another file system`,
+	)
+	flags.StringVar(&stateDir,
+		`state-dir`,
+		``,
+		`dir of the resume state (default is beside the output)`,
+	)
+	flags.BoolVar(&preallocate,
+		`preallocate`,
+		false,
+		`allocate the whole file on the disk before downloading so the disk cannot fill up while downloading, only supported on linux`,
+	)
 	flags.BoolVarP(&yes,
 		`yes`, `y`,
 		false,
@@ -160,6 +345,29 @@ mget get -u http://127.0.0.1/tools/source.exe -o a.exe`,
 		ascii,
 		`if ASCII is true then use ASCII instead of unicode to draw the`,
 	)
+	flags.BoolVar(&headless,
+		`headless`,
+		false,
+		`print progress as plain text to stderr instead of drawing a terminal ui (default true if stdout is not a terminal)`,
+	)
+	flags.StringVar(&events,
+		`events`,
+		``,
+		`write newline-delimited JSON progress events to a file, - for stdout with --headless (other messages go to stderr) or fd:N`,
+	)
+	tlsFlags(cmd, &tlsOptions)
+	transportFlags(cmd, &transport, &stallTimeout)
+	configFlags(cmd, &configFile, &profileName)
 
 	rootCmd.AddCommand(cmd)
 }
+
+// viewRely lets the terminal ui control the download
+type viewRely struct {
+	*download.Downloader
+	ascii bool
+}
+
+func (r viewRely) ASCII() bool {
+	return r.ascii
+}
@@ -3,16 +3,22 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"golang.org/x/term"
 )
 
-func readBool(r *bufio.Reader, placeholder string) (val bool) {
+func readBool(r *bufio.Reader, w io.Writer, placeholder string) (val bool) {
 	for {
-		fmt.Fprintf(os.Stdout, `%s : `, placeholder)
+		fmt.Fprintf(w, `%s : `, placeholder)
 		b, _, e := r.ReadLine()
 		if e != nil {
 			fmt.Fprintln(os.Stderr, e)
+			if e == io.EOF {
+				break
+			}
 			continue
 		}
 		str := strings.ToLower(strings.TrimSpace(string(b)))
@@ -30,3 +36,14 @@ func readBool(r *bufio.Reader, placeholder string) (val bool) {
 	}
 	return
 }
+
+// humanOutput returns the writer of the messages for humans, it is stderr if the events are written to stdout
+func humanOutput(events string) io.Writer {
+	if events == `-` {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
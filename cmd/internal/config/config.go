@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	net_url "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Options are the download options which can be set by the config file, empty fields are not set
+type Options struct {
+	Proxy         string   `yaml:"proxy"`
+	Agent         string   `yaml:"agent"`
+	Header        []string `yaml:"header"`
+	Cookie        []string `yaml:"cookie"`
+	Worker        int      `yaml:"worker"`
+	Block         string   `yaml:"block"`
+	Insecure      *bool    `yaml:"insecure"`
+	CACert        string   `yaml:"cacert"`
+	Cert          string   `yaml:"cert"`
+	Key           string   `yaml:"key"`
+	TLSMin        string   `yaml:"tls-min"`
+	SNI           string   `yaml:"sni"`
+	Pin           []string `yaml:"pin"`
+	ProxyCACert   string   `yaml:"proxy-cacert"`
+	ProxyInsecure *bool    `yaml:"proxy-insecure"`
+	Store         string   `yaml:"store"`
+	TempDir       string   `yaml:"temp-dir"`
+	StateDir      string   `yaml:"state-dir"`
+	Preallocate   *bool    `yaml:"preallocate"`
+}
+
+// Merge sets the fields set in src, a header replaces the header of the same key and cookies are appended
+func (o *Options) Merge(src *Options) {
+	if src.Proxy != `` {
+		o.Proxy = src.Proxy
+	}
+	if src.Agent != `` {
+		o.Agent = src.Agent
+	}
+	o.Header = MergeHeader(o.Header, src.Header)
+	if len(src.Cookie) != 0 {
+		o.Cookie = append(append([]string(nil), o.Cookie...), src.Cookie...)
+	}
+	if src.Worker != 0 {
+		o.Worker = src.Worker
+	}
+	if src.Block != `` {
+		o.Block = src.Block
+	}
+	if src.Insecure != nil {
+		insecure := *src.Insecure
+		o.Insecure = &insecure
+	}
+	if src.CACert != `` {
+		o.CACert = src.CACert
+	}
+	if src.Cert != `` {
+		o.Cert = src.Cert
+		// the key of another cert must not be used
+		o.Key = src.Key
+	} else if src.Key != `` {
+		o.Key = src.Key
+	}
+	if src.TLSMin != `` {
+		o.TLSMin = src.TLSMin
+	}
+	if src.SNI != `` {
+		o.SNI = src.SNI
+	}
+	if len(src.Pin) != 0 {
+		o.Pin = src.Pin
+	}
+	if src.ProxyCACert != `` {
+		o.ProxyCACert = src.ProxyCACert
+	}
+	if src.ProxyInsecure != nil {
+		insecure := *src.ProxyInsecure
+		o.ProxyInsecure = &insecure
+	}
+	if src.Store != `` {
+		o.Store = src.Store
+	}
+	if src.TempDir != `` {
+		o.TempDir = src.TempDir
+	}
+	if src.StateDir != `` {
+		o.StateDir = src.StateDir
+	}
+	if src.Preallocate != nil {
+		preallocate := *src.Preallocate
+		o.Preallocate = &preallocate
+	}
+}
+
+// Host is the options applied automatically to the urls of the host
+type Host struct {
+	// host name or host:port, it may contain the patterns of path.Match such as *.example.com
+	Host    string `yaml:"host"`
+	Options `yaml:",inline"`
+}
+
+func (h *Host) match(u *net_url.URL) bool {
+	pattern := strings.ToLower(h.Host)
+	name := strings.ToLower(u.Hostname())
+	if _, _, e := net.SplitHostPort(pattern); e == nil {
+		name = strings.ToLower(u.Host)
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// Config is the config file, the options at the top level are the defaults of every download
+type Config struct {
+	Options  `yaml:",inline"`
+	Profiles map[string]Options `yaml:"profiles"`
+	Hosts    []Host             `yaml:"hosts"`
+}
+
+// DefaultFilename returns the config file in the user config dir such as ~/.config/mget/config.yaml
+func DefaultFilename() string {
+	dir, e := os.UserConfigDir()
+	if e != nil {
+		return ``
+	}
+	return filepath.Join(dir, `mget`, `config.yaml`)
+}
+
+// Load reads the config file, a missing file is an empty config if it is not required
+func Load(filename string, required bool) (c *Config, e error) {
+	c = &Config{}
+	if filename == `` {
+		return
+	}
+	b, e := os.ReadFile(filename)
+	if e != nil {
+		if os.IsNotExist(e) && !required {
+			e = nil
+		}
+		return
+	}
+	e = yaml.UnmarshalStrict(b, c)
+	if e != nil {
+		e = fmt.Errorf(`config %s: %w`, filename, e)
+		return
+	}
+	for i := range c.Hosts {
+		if c.Hosts[i].Host == `` {
+			e = fmt.Errorf(`config %s: host of hosts[%v] is empty`, filename, i)
+			return
+		} else if _, e = path.Match(c.Hosts[i].Host, ``); e != nil {
+			e = fmt.Errorf(`config %s: host %s: %w`, filename, c.Hosts[i].Host, e)
+			return
+		}
+	}
+	return
+}
+
+// Resolve returns the options of the url, the defaults are overridden by the matched hosts in order and then by the profile
+func (c *Config) Resolve(profile, url string) (o Options, e error) {
+	o.Merge(&c.Options)
+	if u, err := net_url.Parse(url); err == nil && u.Host != `` {
+		for i := range c.Hosts {
+			if c.Hosts[i].match(u) {
+				o.Merge(&c.Hosts[i].Options)
+			}
+		}
+	}
+	if profile != `` {
+		p, ok := c.Profiles[profile]
+		if !ok {
+			e = fmt.Errorf(`profile not found: %s`, profile)
+			return
+		}
+		o.Merge(&p)
+	}
+	return
+}
+
+// MergeHeader appends the headers of src to dst, a header of dst is removed if src has the same key
+func MergeHeader(dst, src []string) []string {
+	if len(src) == 0 {
+		return dst
+	}
+	keys := make(map[string]bool, len(src))
+	for _, str := range src {
+		keys[headerKey(str)] = true
+	}
+	headers := make([]string, 0, len(dst)+len(src))
+	for _, str := range dst {
+		if !keys[headerKey(str)] {
+			headers = append(headers, str)
+		}
+	}
+	return append(headers, src...)
+}
+func headerKey(str string) string {
+	strs := strings.SplitN(str, `:`, 2)
+	return strings.ToLower(strings.TrimSpace(strs[0]))
+}
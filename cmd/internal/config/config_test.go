@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+worker: 8
+header:
+  - "Accept: */*"
+  - "Accept-Language: en"
+cookie:
+  - "a=1"
+profiles:
+  office:
+    proxy: socks5://127.0.0.1:1080
+    worker: 2
+    header:
+      - "accept-language: zh"
+    cookie:
+      - "c=3"
+hosts:
+  - host: "*.example.com"
+    worker: 4
+    cacert: /etc/mget/ca.pem
+    header:
+      - "Authorization: Bearer xxx"
+  - host: cdn.example.com:8443
+    cert: /etc/mget/client.pem
+    key: /etc/mget/client.key
+    cookie:
+      - "b=2"
+  - host: EXAMPLE.org
+    proxy: http://127.0.0.1:8080
+`
+
+func load(t *testing.T, str string) (*Config, error) {
+	filename := filepath.Join(t.TempDir(), `config.yaml`)
+	e := os.WriteFile(filename, []byte(str), 0600)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return Load(filename, true)
+}
+func TestResolve(t *testing.T) {
+	c, e := load(t, testConfig)
+	if e != nil {
+		t.Fatal(e)
+	}
+	auth := []string{`Accept: */*`, `Accept-Language: en`, `Authorization: Bearer xxx`}
+	tests := []struct {
+		profile string
+		url     string
+		options Options
+	}{
+		{``, `http://other.test/a`, Options{Worker: 8, Header: auth[:2], Cookie: []string{`a=1`}}},
+		// the host name is case insensitive and the port is not matched by a host without port
+		{``, `https://Example.ORG:8080/a`, Options{Worker: 8, Header: auth[:2], Cookie: []string{`a=1`}, Proxy: `http://127.0.0.1:8080`}},
+		{``, `https://www.example.com/a`, Options{Worker: 4, Header: auth, Cookie: []string{`a=1`}, CACert: `/etc/mget/ca.pem`}},
+		// the hosts are merged in order
+		{``, `https://cdn.example.com:8443/a`, Options{
+			Worker: 4, Header: auth, Cookie: []string{`a=1`, `b=2`},
+			CACert: `/etc/mget/ca.pem`, Cert: `/etc/mget/client.pem`, Key: `/etc/mget/client.key`,
+		}},
+		{``, `https://cdn.example.com/a`, Options{Worker: 4, Header: auth, Cookie: []string{`a=1`}, CACert: `/etc/mget/ca.pem`}},
+		// the profile overrides the hosts and replaces the header of the same key
+		{`office`, `https://cdn.example.com:8443/a`, Options{
+			Worker: 2, Proxy: `socks5://127.0.0.1:1080`,
+			Header: []string{`Accept: */*`, `Authorization: Bearer xxx`, `accept-language: zh`},
+			Cookie: []string{`a=1`, `b=2`, `c=3`},
+			CACert: `/etc/mget/ca.pem`, Cert: `/etc/mget/client.pem`, Key: `/etc/mget/client.key`,
+		}},
+		{`office`, ``, Options{
+			Worker: 2, Proxy: `socks5://127.0.0.1:1080`,
+			Header: []string{`Accept: */*`, `accept-language: zh`},
+			Cookie: []string{`a=1`, `c=3`},
+		}},
+	}
+	for _, test := range tests {
+		o, e := c.Resolve(test.profile, test.url)
+		if e != nil {
+			t.Fatal(e)
+		} else if !reflect.DeepEqual(o, test.options) {
+			t.Errorf("%s %s:\nexpected %+v\ngot      %+v", test.profile, test.url, test.options, o)
+		}
+	}
+
+	// resolving does not change the config
+	if o, _ := c.Resolve(``, `http://other.test/a`); !reflect.DeepEqual(o, tests[0].options) {
+		t.Errorf(`config changed: %+v`, o)
+	}
+	if _, e = c.Resolve(`home`, `http://other.test/a`); e == nil {
+		t.Error(`unknown profile not reported`)
+	}
+}
+func TestMergeHeader(t *testing.T) {
+	tests := []struct {
+		dst, src []string
+		headers  []string
+	}{
+		{nil, nil, nil},
+		{[]string{`A: 1`}, nil, []string{`A: 1`}},
+		{nil, []string{`A: 1`}, []string{`A: 1`}},
+		{[]string{`A: 1`, `B: 2`}, []string{` a : 3`}, []string{`B: 2`, ` a : 3`}},
+		// every header of the key is replaced
+		{[]string{`A: 1`, `B: 2`, `a: 4`}, []string{`A: 3`, `A: 5`}, []string{`B: 2`, `A: 3`, `A: 5`}},
+	}
+	for _, test := range tests {
+		if headers := MergeHeader(test.dst, test.src); !reflect.DeepEqual(headers, test.headers) {
+			t.Errorf(`%q + %q: expected %q got %q`, test.dst, test.src, test.headers, headers)
+		}
+	}
+}
+func TestLoad(t *testing.T) {
+	tests := []string{
+		`workers: 8`,
+		`hosts: [{worker: 2}]`,
+		`hosts: [{host: "[a"}]`,
+	}
+	for _, test := range tests {
+		if _, e := load(t, test); e == nil {
+			t.Errorf(`%s: error not reported`, test)
+		}
+	}
+	if c, e := Load(filepath.Join(t.TempDir(), `config.yaml`), false); e != nil || !reflect.DeepEqual(c, &Config{}) {
+		t.Errorf(`missing config: %v %+v`, e, c)
+	} else if _, e = Load(filepath.Join(t.TempDir(), `config.yaml`), true); e == nil {
+		t.Error(`missing required config not reported`)
+	}
+}
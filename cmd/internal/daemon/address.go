@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultAddress returns mget.sock in $XDG_RUNTIME_DIR, or in a dir of the user in the temp dir
+func DefaultAddress() string {
+	dir, _ := defaultDir()
+	return filepath.Join(dir, `mget.sock`)
+}
+
+// defaultDir returns the dir of the default socket, private is true if the dir is created by mget
+func defaultDir() (dir string, private bool) {
+	if dir = os.Getenv(`XDG_RUNTIME_DIR`); dir != `` {
+		return
+	}
+	if uid := os.Getuid(); uid >= 0 {
+		return filepath.Join(os.TempDir(), `mget-`+strconv.Itoa(uid)), true
+	}
+	// the temp dir of windows belongs to the user
+	return os.TempDir(), false
+}
+
+// Network returns the network of the address, unix:xxx tcp:xxx or host:port is tcp otherwise a unix socket path
+func Network(address string) (network, addr string) {
+	if strings.HasPrefix(address, `unix:`) {
+		return `unix`, address[len(`unix:`):]
+	} else if strings.HasPrefix(address, `tcp:`) {
+		return `tcp`, address[len(`tcp:`):]
+	} else if _, port, e := net.SplitHostPort(address); e == nil {
+		if _, e = strconv.ParseUint(port, 10, 16); e == nil {
+			return `tcp`, address
+		}
+	}
+	return `unix`, address
+}
+
+// Listen listens on the address.
+// The api is not authenticated, so a unix socket can only be used by the user and tcp can only listen on loopback.
+func Listen(address string) (l net.Listener, e error) {
+	network, addr := Network(address)
+	if network == `tcp` {
+		e = checkLoopback(addr)
+		if e != nil {
+			return
+		}
+		return net.Listen(network, addr)
+	}
+	if dir, private := defaultDir(); private && filepath.Dir(addr) == dir {
+		e = mkdirPrivate(dir)
+		if e != nil {
+			return
+		}
+	}
+	if info, err := os.Lstat(addr); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			e = fmt.Errorf(`%s exists and is not a socket`, addr)
+			return
+		}
+		if c, err := net.Dial(network, addr); err == nil {
+			c.Close()
+			e = fmt.Errorf(`daemon already listening on %s`, addr)
+			return
+		}
+		// remove the socket left by a daemon not exited normally
+		os.Remove(addr)
+	}
+	l, e = net.Listen(network, addr)
+	if e != nil {
+		return
+	}
+	e = os.Chmod(addr, 0600)
+	if e != nil {
+		l.Close()
+		l = nil
+	}
+	return
+}
+
+// mkdirPrivate creates the dir only accessible by the user, a dir created by another user is not used
+func mkdirPrivate(dir string) (e error) {
+	e = os.MkdirAll(dir, 0700)
+	if e != nil {
+		return
+	}
+	info, e := os.Lstat(dir)
+	if e != nil {
+		return
+	} else if !info.IsDir() {
+		e = fmt.Errorf(`%s is not a dir`, dir)
+	} else if info.Mode().Perm()&0077 != 0 {
+		e = fmt.Errorf(`%s can be accessed by other users, mode %v`, dir, info.Mode().Perm())
+	}
+	return
+}
+func checkLoopback(addr string) (e error) {
+	host, _, e := net.SplitHostPort(addr)
+	if e != nil {
+		return
+	}
+	if host == `localhost` {
+		return
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		e = fmt.Errorf(`the api is not authenticated, tcp can only listen on a loopback address: %s`, addr)
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// Client calls the api of a running daemon
+type Client struct {
+	client *http.Client
+	url    string
+}
+
+func NewClient(address string) *Client {
+	network, addr := Network(address)
+	var dialer net.Dialer
+	url := `http://mget`
+	if network == `tcp` {
+		url = `http://` + addr
+	}
+	return &Client{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr)
+				},
+			},
+		},
+		url: url,
+	}
+}
+func (c *Client) List(ctx context.Context) (jobs []Job, e error) {
+	e = c.do(ctx, http.MethodGet, `/jobs`, nil, &jobs)
+	return
+}
+func (c *Client) Get(ctx context.Context, id int64) (job Job, e error) {
+	e = c.do(ctx, http.MethodGet, `/jobs/`+strconv.FormatInt(id, 10), nil, &job)
+	return
+}
+func (c *Client) Add(ctx context.Context, req *AddRequest) (job Job, e error) {
+	e = c.do(ctx, http.MethodPost, `/jobs`, req, &job)
+	return
+}
+func (c *Client) Remove(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, `/jobs/`+strconv.FormatInt(id, 10), nil, nil)
+}
+func (c *Client) Pause(ctx context.Context, id int64) error {
+	return c.action(ctx, id, `pause`, nil)
+}
+func (c *Client) Resume(ctx context.Context, id int64) error {
+	return c.action(ctx, id, `resume`, nil)
+}
+func (c *Client) SetPriority(ctx context.Context, id int64, priority int) error {
+	return c.action(ctx, id, `priority`, priorityRequest{Priority: priority})
+}
+func (c *Client) Increase(ctx context.Context, id int64, n int) error {
+	return c.action(ctx, id, `increase`, workerRequest{N: n})
+}
+func (c *Client) Reduce(ctx context.Context, id int64, n int) error {
+	return c.action(ctx, id, `reduce`, workerRequest{N: n})
+}
+func (c *Client) action(ctx context.Context, id int64, action string, body interface{}) error {
+	return c.do(ctx, http.MethodPost, `/jobs/`+strconv.FormatInt(id, 10)+`/`+action, body, nil)
+}
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) (e error) {
+	var r io.Reader
+	if body != nil {
+		var b []byte
+		b, e = json.Marshal(body)
+		if e != nil {
+			return
+		}
+		r = bytes.NewReader(b)
+	}
+	req, e := http.NewRequestWithContext(ctx, method, c.url+path, r)
+	if e != nil {
+		return
+	}
+	if body != nil {
+		req.Header.Set(`Content-Type`, `application/json`)
+	}
+	resp, e := c.client.Do(req)
+	if e != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var er errorResponse
+		if json.NewDecoder(resp.Body).Decode(&er) == nil && er.Error != `` {
+			e = errors.New(er.Error)
+		} else {
+			e = errors.New(resp.Status)
+		}
+		return
+	}
+	if result != nil {
+		e = json.NewDecoder(resp.Body).Decode(result)
+	}
+	return
+}
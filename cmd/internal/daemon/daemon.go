@@ -0,0 +1,378 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/zuiwuchang/mget/download"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+var (
+	ErrNotFound = errors.New(`job not found`)
+	ErrState    = errors.New(`not supported in the current state of the job`)
+	ErrExists   = errors.New(`file already exists`)
+)
+
+type NewOptions func(url, output string, header []string, worker int) (*download.Options, error)
+
+// Daemon downloads the queued jobs, at most jobs downloads run at the same time
+type Daemon struct {
+	ctx        context.Context
+	newOptions NewOptions
+	jobs       int
+	limiter    *utils.Limiter
+	filename   string
+
+	m       sync.Mutex
+	id      int64
+	items   []*Job
+	running int
+	wait    sync.WaitGroup
+}
+
+// New creates a daemon, if filename is not empty the queue is saved to it and loaded on the next start
+func New(jobs int, limiter *utils.Limiter, filename string, newOptions NewOptions) (d *Daemon, e error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+	d = &Daemon{
+		newOptions: newOptions,
+		jobs:       jobs,
+		limiter:    limiter,
+		filename:   filename,
+	}
+	e = d.load()
+	if e != nil {
+		d = nil
+	}
+	return
+}
+func (d *Daemon) load() (e error) {
+	if d.filename == `` {
+		return
+	}
+	b, e := os.ReadFile(d.filename)
+	if e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	e = json.Unmarshal(b, &d.items)
+	if e != nil {
+		return
+	}
+	for _, j := range d.items {
+		if j.ID > d.id {
+			d.id = j.ID
+		}
+		if j.State == StateRunning {
+			j.State = StateQueued
+		}
+	}
+	return
+}
+func (d *Daemon) save() {
+	if d.filename == `` {
+		return
+	}
+	items := make([]Job, len(d.items))
+	for i, j := range d.items {
+		items[i] = j.snapshot()
+	}
+	b, e := json.MarshalIndent(items, ``, "\t")
+	if e != nil {
+		log.Error(`save queue: `, e)
+		return
+	}
+	temp := d.filename + `.tmp`
+	e = os.WriteFile(temp, b, 0600)
+	if e == nil {
+		e = os.Rename(temp, d.filename)
+	}
+	if e != nil {
+		log.Error(`save queue: `, e)
+	}
+}
+
+// Serve handles the api on l until ctx is done, running jobs are queued again for the next start
+func (d *Daemon) Serve(ctx context.Context, l net.Listener) (e error) {
+	// the jobs are also stopped if the server fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	d.m.Lock()
+	d.ctx = ctx
+	d.schedule()
+	d.m.Unlock()
+
+	srv := &http.Server{
+		Handler: d,
+	}
+	ch := make(chan error, 1)
+	go func() {
+		ch <- srv.Serve(l)
+	}()
+	select {
+	case e = <-ch:
+	case <-ctx.Done():
+		srv.Shutdown(context.Background())
+	}
+	cancel()
+	d.wait.Wait()
+	return
+}
+func (d *Daemon) List() []Job {
+	d.m.Lock()
+	defer d.m.Unlock()
+	items := make([]Job, len(d.items))
+	for i, j := range d.items {
+		items[i] = j.snapshot()
+	}
+	return items
+}
+func (d *Daemon) Get(id int64) (job Job, e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, _ := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	}
+	job = j.snapshot()
+	return
+}
+func (d *Daemon) Add(req *AddRequest) (job Job, e error) {
+	// validate the request before it is queued
+	opts, e := d.newOptions(req.URL, req.Output, req.Header, req.Worker)
+	if e != nil {
+		return
+	}
+	output, exists, e := opts.Check()
+	if e != nil {
+		return
+	} else if exists && !req.Overwrite {
+		e = ErrExists
+		return
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.id++
+	j := &Job{
+		ID:       d.id,
+		URL:      req.URL,
+		Output:   output,
+		Header:   req.Header,
+		Worker:   req.Worker,
+		Priority: req.Priority,
+		State:    StateQueued,
+	}
+	d.items = append(d.items, j)
+	log.Info(`add job `, j.ID, `: `, j.URL, ` -> `, j.Output)
+	d.schedule()
+	d.save()
+	job = j.snapshot()
+	return
+}
+func (d *Daemon) Remove(id int64) (e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, i := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	}
+	d.items = append(d.items[:i], d.items[i+1:]...)
+	j.removed = true
+	if j.cancel != nil {
+		j.cancel()
+	}
+	log.Info(`remove job `, id)
+	d.save()
+	return
+}
+func (d *Daemon) Pause(id int64) (e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, _ := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	}
+	switch j.State {
+	case StateQueued:
+	case StateRunning:
+		j.cancel()
+	default:
+		e = ErrState
+		return
+	}
+	j.State = StatePaused
+	log.Info(`pause job `, id)
+	d.save()
+	return
+}
+func (d *Daemon) Resume(id int64) (e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, _ := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	} else if j.State != StatePaused && j.State != StateFailed {
+		e = ErrState
+		return
+	} else if j.downloader != nil {
+		// still stopping
+		e = ErrState
+		return
+	}
+	j.State = StateQueued
+	j.Error = ``
+	log.Info(`resume job `, id)
+	d.schedule()
+	d.save()
+	return
+}
+func (d *Daemon) SetPriority(id int64, priority int) (e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, _ := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	}
+	j.Priority = priority
+	d.schedule()
+	d.save()
+	return
+}
+
+// Increase adds n workers to the job, a negative n reduces workers
+func (d *Daemon) Increase(id int64, n int) (e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	j, _ := d.find(id)
+	if j == nil {
+		e = ErrNotFound
+		return
+	}
+	if j.downloader == nil {
+		worker := j.Worker
+		if worker < 1 {
+			var opts *download.Options
+			opts, e = d.newOptions(j.URL, j.Output, j.Header, j.Worker)
+			if e != nil {
+				return
+			}
+			worker = opts.Worker
+		}
+		worker += n
+		if maxWorkers := download.MaxWorkers(); worker > maxWorkers {
+			worker = maxWorkers
+		} else if worker < 1 {
+			worker = 1
+		}
+		j.Worker = worker
+	} else {
+		for ; n > 0; n-- {
+			j.downloader.Increase()
+		}
+		for ; n < 0; n++ {
+			j.downloader.Reduce()
+		}
+		j.Worker = j.downloader.Progress().Workers
+	}
+	d.save()
+	return
+}
+func (d *Daemon) find(id int64) (*Job, int) {
+	for i, j := range d.items {
+		if j.ID == id {
+			return j, i
+		}
+	}
+	return nil, -1
+}
+func (d *Daemon) schedule() {
+	if d.ctx == nil || d.ctx.Err() != nil {
+		return
+	}
+	for d.running < d.jobs {
+		var next *Job
+		for _, j := range d.items {
+			if j.State == StateQueued && (next == nil || j.Priority > next.Priority) {
+				next = j
+			}
+		}
+		if next == nil {
+			break
+		}
+		d.start(next)
+	}
+}
+func (d *Daemon) start(j *Job) {
+	opts, e := d.newOptions(j.URL, j.Output, j.Header, j.Worker)
+	if e != nil {
+		j.State = StateFailed
+		j.Error = e.Error()
+		return
+	}
+	ctx, cancel := context.WithCancel(d.ctx)
+	downloader, e := download.New(ctx, opts)
+	if e != nil {
+		cancel()
+		j.State = StateFailed
+		j.Error = e.Error()
+		return
+	}
+	downloader.SetLimiter(d.limiter)
+	j.downloader = downloader
+	j.cancel = cancel
+	j.State = StateRunning
+	j.Error = ``
+	d.running++
+	log.Info(`start job `, j.ID, `: `, j.URL)
+
+	d.wait.Add(1)
+	go func() {
+		defer d.wait.Done()
+		e := downloader.Serve()
+		cancel()
+		d.finish(j, e)
+	}()
+}
+func (d *Daemon) finish(j *Job, e error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.running--
+	j.setProgress(j.downloader.Progress())
+	j.Speed, j.ETA = 0, 0
+	j.downloader = nil
+	j.cancel = nil
+	if j.removed {
+		d.schedule()
+		return
+	}
+	switch {
+	case j.State == StatePaused:
+	case d.ctx.Err() != nil:
+		j.State = StateQueued
+	case e == nil:
+		j.State = StateSuccess
+		log.Info(`job `, j.ID, ` success: `, j.Output)
+	default:
+		j.State = StateFailed
+		j.Error = e.Error()
+		log.Error(`job `, j.ID, ` failed: `, e)
+	}
+	d.schedule()
+	d.save()
+}
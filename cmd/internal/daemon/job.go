@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"context"
+
+	"github.com/zuiwuchang/mget/download"
+)
+
+const (
+	StateQueued  = `queued`
+	StateRunning = `running`
+	StatePaused  = `paused`
+	StateSuccess = `success`
+	StateFailed  = `failed`
+)
+
+type AddRequest struct {
+	URL       string   `json:"url"`
+	Output    string   `json:"output"`
+	Header    []string `json:"header,omitempty"`
+	Worker    int      `json:"worker,omitempty"`
+	Priority  int      `json:"priority,omitempty"`
+	Overwrite bool     `json:"overwrite,omitempty"`
+}
+
+// Job is a download in the queue, jobs with a higher priority are started first
+type Job struct {
+	ID       int64    `json:"id"`
+	URL      string   `json:"url"`
+	Output   string   `json:"output"`
+	Header   []string `json:"header,omitempty"`
+	Worker   int      `json:"worker,omitempty"`
+	Priority int      `json:"priority"`
+	State    string   `json:"state"`
+	Error    string   `json:"error,omitempty"`
+
+	Status     string `json:"status,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Downloaded int64  `json:"downloaded,omitempty"`
+	Speed      int64  `json:"speed,omitempty"`
+	// seconds
+	ETA int64 `json:"eta,omitempty"`
+
+	downloader *download.Downloader
+	cancel     context.CancelFunc
+	removed    bool
+}
+
+func (j *Job) snapshot() Job {
+	job := *j
+	job.downloader = nil
+	job.cancel = nil
+	if j.downloader != nil {
+		progress := j.downloader.Progress()
+		job.setProgress(progress)
+		job.Worker = progress.Workers
+	}
+	return job
+}
+func (j *Job) setProgress(progress download.Progress) {
+	j.Status = progress.Status.String()
+	j.Size = progress.Size
+	j.Downloaded = progress.Downloaded
+	j.Speed = progress.Speed
+	j.ETA = int64(progress.ETA.Seconds())
+}
@@ -0,0 +1,136 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+type priorityRequest struct {
+	Priority int `json:"priority"`
+}
+type workerRequest struct {
+	N int `json:"n"`
+}
+
+// ServeHTTP implements the api
+//
+//	GET    /jobs                list jobs
+//	POST   /jobs                add a job, body is AddRequest
+//	GET    /jobs/{id}           get a job
+//	DELETE /jobs/{id}           cancel and remove a job
+//	POST   /jobs/{id}/pause     pause a job
+//	POST   /jobs/{id}/resume    resume a paused or failed job
+//	POST   /jobs/{id}/priority  {"priority": n}
+//	POST   /jobs/{id}/increase  {"n": n} increase workers
+//	POST   /jobs/{id}/reduce    {"n": n} reduce workers
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	strs := strings.Split(strings.Trim(r.URL.Path, `/`), `/`)
+	if strs[0] != `jobs` {
+		d.writeError(w, http.StatusNotFound, errors.New(`not found`))
+		return
+	}
+	if len(strs) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			d.writeJSON(w, http.StatusOK, d.List())
+		case http.MethodPost:
+			var req AddRequest
+			if !d.readJSON(w, r, &req) {
+				return
+			}
+			job, e := d.Add(&req)
+			if e != nil {
+				d.writeError(w, http.StatusBadRequest, e)
+				return
+			}
+			d.writeJSON(w, http.StatusCreated, job)
+		default:
+			d.writeError(w, http.StatusMethodNotAllowed, errors.New(`method not allowed`))
+		}
+		return
+	}
+	id, e := strconv.ParseInt(strs[1], 10, 64)
+	if e != nil || len(strs) > 3 {
+		d.writeError(w, http.StatusNotFound, errors.New(`not found`))
+		return
+	}
+	if len(strs) == 2 {
+		switch r.Method {
+		case http.MethodGet:
+			job, e := d.Get(id)
+			if e != nil {
+				d.writeError(w, http.StatusNotFound, e)
+				return
+			}
+			d.writeJSON(w, http.StatusOK, job)
+		case http.MethodDelete:
+			d.writeResult(w, d.Remove(id))
+		default:
+			d.writeError(w, http.StatusMethodNotAllowed, errors.New(`method not allowed`))
+		}
+		return
+	}
+	if r.Method != http.MethodPost {
+		d.writeError(w, http.StatusMethodNotAllowed, errors.New(`method not allowed`))
+		return
+	}
+	switch strs[2] {
+	case `pause`:
+		d.writeResult(w, d.Pause(id))
+	case `resume`:
+		d.writeResult(w, d.Resume(id))
+	case `priority`:
+		var req priorityRequest
+		if d.readJSON(w, r, &req) {
+			d.writeResult(w, d.SetPriority(id, req.Priority))
+		}
+	case `increase`, `reduce`:
+		req := workerRequest{N: 1}
+		if !d.readJSON(w, r, &req) {
+			return
+		}
+		if strs[2] == `reduce` {
+			req.N = -req.N
+		}
+		d.writeResult(w, d.Increase(id, req.N))
+	default:
+		d.writeError(w, http.StatusNotFound, errors.New(`not found`))
+	}
+}
+func (d *Daemon) readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.ContentLength == 0 {
+		return true
+	}
+	e := json.NewDecoder(r.Body).Decode(v)
+	if e != nil {
+		d.writeError(w, http.StatusBadRequest, e)
+		return false
+	}
+	return true
+}
+func (d *Daemon) writeResult(w http.ResponseWriter, e error) {
+	switch e {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrNotFound:
+		d.writeError(w, http.StatusNotFound, e)
+	case ErrState:
+		d.writeError(w, http.StatusConflict, e)
+	default:
+		d.writeError(w, http.StatusBadRequest, e)
+	}
+}
+func (d *Daemon) writeError(w http.ResponseWriter, code int, e error) {
+	d.writeJSON(w, code, errorResponse{Error: e.Error()})
+}
+func (d *Daemon) writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set(`Content-Type`, `application/json`)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
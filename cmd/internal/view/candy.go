@@ -26,3 +26,11 @@ func (v *View) SetWorker(body string) {
 		v.viewWorker.SetBody(body)
 	}
 }
+func (v *View) Exit(e error) {
+	v.Update(func(g *gocui.Gui) error {
+		if e == nil {
+			return gocui.ErrQuit
+		}
+		return e
+	})
+}
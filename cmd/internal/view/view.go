@@ -5,13 +5,17 @@ import (
 	"strings"
 
 	"github.com/jroimartin/gocui"
-	"github.com/zuiwuchang/mget/cmd/internal/log"
+	"github.com/zuiwuchang/mget/internal/log"
 	"github.com/zuiwuchang/mget/widget"
 )
 
 type Rely interface {
 	Increase()
 	Reduce()
+	IncreaseRate()
+	ReduceRate()
+	UnlimitRate()
+	TogglePause()
 	ConfigureView() string
 	ASCII() bool
 }
@@ -31,6 +35,16 @@ var (
 		ViewLog,
 		ViewMenu,
 	}
+	Menus = []string{
+		`w: increase worker`,
+		`s: reduce worker`,
+		`e: increase rate limit`,
+		`d: reduce rate limit`,
+		`u: unlimited rate`,
+		`p: pause/resume download`,
+		`m: toggle menu display`,
+		`l: toggle log display`,
+	}
 )
 
 const (
@@ -90,6 +104,14 @@ func (v *View) Init() (e error) {
 		return
 	} else if e = g.SetKeybinding(``, 's', gocui.ModNone, v.reduceWorker); e != nil {
 		return
+	} else if e = g.SetKeybinding(``, 'e', gocui.ModNone, v.increaseRate); e != nil {
+		return
+	} else if e = g.SetKeybinding(``, 'd', gocui.ModNone, v.reduceRate); e != nil {
+		return
+	} else if e = g.SetKeybinding(``, 'u', gocui.ModNone, v.unlimitRate); e != nil {
+		return
+	} else if e = g.SetKeybinding(``, 'p', gocui.ModNone, v.togglePause); e != nil {
+		return
 	} else if e = g.SetKeybinding(``, gocui.KeyTab, gocui.ModNone, v.tab); e != nil {
 		return
 	} else if e = g.SetKeybinding(``, gocui.MouseLeft, gocui.ModNone, v.current); e != nil {
@@ -106,10 +128,7 @@ func (v *View) toggleMenu(g *gocui.Gui, _ *gocui.View) error {
 		if v.viewMenu == nil {
 			var e error
 			v.viewMenu, e = widget.NewWidget(g, ViewMenu,
-				`w: increase worker
-s: reduce worker
-m: toggle menu display
-l: toggle log display`,
+				strings.Join(Menus, "\n"),
 				widget.NewLayout(func() (x int, y int, w int, h int) {
 					x, _ = g.Size()
 					x -= MenuWidth + 1
@@ -301,6 +320,22 @@ func (v *View) reduceWorker(g *gocui.Gui, _ *gocui.View) error {
 	v.rely.Reduce()
 	return nil
 }
+func (v *View) increaseRate(g *gocui.Gui, _ *gocui.View) error {
+	v.rely.IncreaseRate()
+	return nil
+}
+func (v *View) reduceRate(g *gocui.Gui, _ *gocui.View) error {
+	v.rely.ReduceRate()
+	return nil
+}
+func (v *View) unlimitRate(g *gocui.Gui, _ *gocui.View) error {
+	v.rely.UnlimitRate()
+	return nil
+}
+func (v *View) togglePause(g *gocui.Gui, _ *gocui.View) error {
+	v.rely.TogglePause()
+	return nil
+}
 
 func (v *View) clickMenu(g *gocui.Gui, view *gocui.View) error {
 	x, y := view.Cursor()
@@ -314,13 +349,22 @@ func (v *View) upMenu(g *gocui.Gui, view *gocui.View) error {
 	x, y := view.Cursor()
 	if y > 0 {
 		view.SetCursor(x, y-1)
+	} else if ox, oy := view.Origin(); oy > 0 {
+		view.SetOrigin(ox, oy-1)
 	}
 	return nil
 }
 func (v *View) downMenu(g *gocui.Gui, view *gocui.View) error {
 	x, y := view.Cursor()
-	if y < 3 {
+	ox, oy := view.Origin()
+	if oy+y+1 >= len(Menus) {
+		return nil
+	}
+	_, sy := view.Size()
+	if y+1 < sy {
 		view.SetCursor(x, y+1)
+	} else {
+		view.SetOrigin(ox, oy+1)
 	}
 	return nil
 }
@@ -342,6 +386,14 @@ func (v *View) doMenu(g *gocui.Gui, view *gocui.View, y int) error {
 		v.rely.Increase()
 	case "s":
 		v.rely.Reduce()
+	case "e":
+		v.rely.IncreaseRate()
+	case "d":
+		v.rely.ReduceRate()
+	case "u":
+		v.rely.UnlimitRate()
+	case "p":
+		v.rely.TogglePause()
 	}
 	return nil
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/zuiwuchang/mget/download"
+)
+
+// askMismatch prints the diff of the downloaded data and the current metadata and asks what to do if they are not matched
+func askMismatch(d *download.Downloader, w io.Writer) string {
+	mismatch, e := d.Mismatch(context.Background())
+	if e != nil || mismatch == nil {
+		return download.MismatchAbort
+	}
+	fmt.Fprintln(w, `The downloaded data does not match the current metadata:`)
+	for _, str := range mismatch.Diff {
+		fmt.Fprintln(w, `  `+str)
+	}
+	sameFile := mismatch.SameFile
+	placeholder := `Restart from scratch <r> or abort <a>`
+	if sameFile {
+		placeholder = fmt.Sprintf(`Restart from scratch <r>, keep the old block size %s <k> or abort <a>`, mismatch.Block)
+	}
+	r := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(w, `%s : `, placeholder)
+		b, _, e := r.ReadLine()
+		if e != nil {
+			fmt.Fprintln(os.Stderr, e)
+			if e == io.EOF {
+				return download.MismatchAbort
+			}
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(string(b))) {
+		case `r`, `restart`:
+			return download.MismatchRestart
+		case `k`, `keep`, download.MismatchKeepBlock:
+			if sameFile {
+				return download.MismatchKeepBlock
+			}
+		case `a`, `abort`:
+			return download.MismatchAbort
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zuiwuchang/mget/download"
+)
+
+func transportFlags(cmd *cobra.Command, t *download.Transport, stall *time.Duration) {
+	flags := cmd.Flags()
+	*t = download.DefaultTransport()
+	flags.DurationVar(&t.ConnectTimeout,
+		`connect-timeout`,
+		t.ConnectTimeout,
+		`timeout of connecting to the server or the proxy, 0 is no timeout`,
+	)
+	flags.DurationVar(&t.TLSHandshakeTimeout,
+		`tls-handshake-timeout`,
+		t.TLSHandshakeTimeout,
+		`timeout of the tls handshake, 0 is no timeout`,
+	)
+	flags.DurationVar(&t.ResponseHeaderTimeout,
+		`response-header-timeout`,
+		t.ResponseHeaderTimeout,
+		`timeout of waiting for the response header after the request is sent, 0 is no timeout`,
+	)
+	flags.DurationVar(stall,
+		`stall-timeout`,
+		time.Minute,
+		`abort and retry the block request if no byte is received in the duration, 0 is no timeout`,
+	)
+	flags.IntVar(&t.MaxIdleConnsPerHost,
+		`max-idle-conns-per-host`,
+		t.MaxIdleConnsPerHost,
+		`idle connections kept for reuse of every host`,
+	)
+	flags.BoolVar(&t.HTTP2,
+		`http2`,
+		false,
+		`allow HTTP/2, the workers share one connection by multiplexing instead of a connection of every worker`,
+	)
+}
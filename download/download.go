@@ -0,0 +1,258 @@
+// Package download is the resumable multi-connection download engine of mget for embedding in other programs
+package download
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/get"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// SetLogOutput writes the logs of the downloads to w, by default they are kept only for the terminal ui
+func SetLogOutput(w io.Writer) {
+	log.SetOutput(w)
+}
+
+// UI draws the progress of a download, the methods are called by the downloader
+type UI interface {
+	Init() error
+	Close()
+	// MainLoop blocks until Exit is called
+	MainLoop() error
+	SetStatus(body string)
+	SetWorker(body string)
+	// Exit makes MainLoop return, e == nil means the download is finished
+	Exit(e error)
+}
+
+// Status is the state of a download
+type Status = metadata.Status
+
+const (
+	StatusInit     = metadata.StatusInit
+	StatusDownload = metadata.StatusDownload
+	StatusPaused   = metadata.StatusPaused
+	StatusError    = metadata.StatusError
+	StatusMerge    = metadata.StatusMerge
+	StatusVerify   = metadata.StatusVerify
+	StatusSuccess  = metadata.StatusSuccess
+)
+
+// Progress is a snapshot of a download
+type Progress struct {
+	Status  Status
+	Workers int
+	// 0 if the server does not report the size
+	Size       int64
+	Downloaded int64
+	// bytes per second
+	Speed int64
+	// 0 if unknown
+	ETA time.Duration
+}
+
+// Downloader downloads a file, the download is resumed if it was stopped before
+type Downloader struct {
+	conf    *metadata.Configure
+	manager *get.Manager
+}
+
+// New checks the options and creates a downloader, the download is stopped if ctx is canceled
+func New(ctx context.Context, opts *Options) (d *Downloader, e error) {
+	conf, e := opts.configure()
+	if e != nil {
+		return
+	}
+	m := get.NewManager(ctx, conf)
+	if opts.UI != nil {
+		m.SetUI(opts.UI)
+	}
+	if f := opts.OnProgress; f != nil {
+		m.SetProgress(opts.ProgressInterval, func(stat get.Stat) {
+			f(newProgress(stat))
+		})
+	}
+	d = &Downloader{
+		conf:    conf,
+		manager: m,
+	}
+	return
+}
+
+// Download downloads a file with the options and returns after the download stops
+func Download(ctx context.Context, opts *Options) (e error) {
+	d, e := New(ctx, opts)
+	if e != nil {
+		return
+	}
+	return d.Serve()
+}
+func newProgress(stat get.Stat) Progress {
+	return Progress{
+		Status:     stat.Status,
+		Workers:    stat.Workers,
+		Size:       int64(stat.Size),
+		Downloaded: int64(stat.Download),
+		Speed:      stat.Speed,
+		ETA:        stat.ETA,
+	}
+}
+
+// Output returns the absolute path of the output file
+func (d *Downloader) Output() string {
+	return d.conf.Output
+}
+
+// Worker returns the number of workers set by the options
+func (d *Downloader) Worker() int {
+	return d.conf.Worker
+}
+
+// Client returns the http client of the downloader, it can be set to Options.Client to share the connections
+func (d *Downloader) Client() (*http.Client, error) {
+	return d.conf.Client()
+}
+
+// Println prints the options to stdout
+func (d *Downloader) Println() {
+	d.conf.Println()
+}
+
+// Fprintln writes the options to w
+func (d *Downloader) Fprintln(w io.Writer) {
+	d.conf.Fprintln(w)
+}
+
+// Exists returns true if the output file already exists
+func (d *Downloader) Exists() (bool, error) {
+	return d.conf.Exists()
+}
+
+// SetUI replaces the ui of the options, it must be called before Serve
+func (d *Downloader) SetUI(ui UI) {
+	d.manager.SetUI(ui)
+}
+
+// Serve downloads the file and returns after the download is finished or stopped, it can be called only once
+func (d *Downloader) Serve() error {
+	return d.manager.Serve()
+}
+
+// Progress returns the current progress
+func (d *Downloader) Progress() Progress {
+	return newProgress(d.manager.Stat())
+}
+
+// TogglePause pauses the download or resumes the paused download
+func (d *Downloader) TogglePause() {
+	d.manager.TogglePause()
+}
+
+// Increase adds a worker
+func (d *Downloader) Increase() {
+	d.manager.Increase()
+}
+
+// Reduce removes a worker
+func (d *Downloader) Reduce() {
+	d.manager.Reduce()
+}
+
+// IncreaseRate doubles the rate limit
+func (d *Downloader) IncreaseRate() {
+	d.manager.IncreaseRate()
+}
+
+// ReduceRate halves the rate limit, it starts limiting from the current speed if the rate is unlimited
+func (d *Downloader) ReduceRate() {
+	d.manager.ReduceRate()
+}
+
+// UnlimitRate removes the rate limit
+func (d *Downloader) UnlimitRate() {
+	d.manager.UnlimitRate()
+}
+
+// SetLimiter shares the total rate limit with other downloaders, it must be called before Serve
+func (d *Downloader) SetLimiter(limiter *utils.Limiter) {
+	d.manager.SetLimiter(limiter)
+}
+
+// ConfigureView returns the options as human readable lines
+func (d *Downloader) ConfigureView() string {
+	return d.manager.ConfigureView()
+}
+
+// Mismatch is the difference of the downloaded data and the file on the server
+type Mismatch struct {
+	Diff []string
+	// only the block size differs so the old block size can be kept
+	SameFile bool
+	// block size of the downloaded data
+	Block utils.Size
+}
+
+// Mismatch returns nil if there is no downloaded data to resume or it matches the file on the server
+func (d *Downloader) Mismatch(ctx context.Context) (mismatch *Mismatch, e error) {
+	stored, e := db.ReadMetadata(db.NewFiles(d.conf.Output, d.conf.Store, d.conf.TempDir, d.conf.StateDir))
+	if e != nil || stored == nil {
+		return
+	}
+	remote, e := d.conf.GetMetadata(ctx, d.conf.URL)
+	if e != nil || !remote.Range {
+		return
+	}
+	current := &db.Metadata{
+		Size:     utils.Size(remote.Size),
+		Block:    d.conf.Block,
+		Modified: remote.Modified,
+		ETag:     remote.ETag,
+	}
+	diff := stored.Diff(current)
+	if len(diff) == 0 {
+		return
+	}
+	mismatch = &Mismatch{
+		Diff:     diff,
+		SameFile: stored.SameFile(current),
+		Block:    stored.Block,
+	}
+	return
+}
+
+// SetMismatch sets what to do if the downloaded data does not match, it must be called before Serve
+func (d *Downloader) SetMismatch(mismatch string) (e error) {
+	e = metadata.CheckMismatch(mismatch)
+	if e != nil {
+		return
+	}
+	d.conf.Mismatch = mismatch
+	return
+}
+
+// Batch downloads several files which have not been served, jobs files are downloaded at the same time.
+// The workers of the first downloader are shared by all files, limitRate is the total rate of all files and 0 is unlimited.
+// done is called when every file stops if it is not nil.
+func Batch(ctx context.Context, downloaders []*Downloader, jobs int, limitRate utils.Size, events string, done func(d *Downloader, used time.Duration, e error)) error {
+	if len(downloaders) == 0 {
+		return errors.New(`no download of the batch`)
+	}
+	managers := make([]*get.Manager, len(downloaders))
+	for i, d := range downloaders {
+		managers[i] = d.manager
+	}
+	var f func(i int, used time.Duration, e error)
+	if done != nil {
+		f = func(i int, used time.Duration, e error) {
+			done(downloaders[i], used, e)
+		}
+	}
+	return get.NewBatch(managers, jobs, downloaders[0].conf.Worker, limitRate, events, f).Serve(ctx)
+}
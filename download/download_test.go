@@ -0,0 +1,220 @@
+package download
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParallel(t *testing.T) {
+	stores := []string{StoreBolt, StoreJournal, StoreJSON, StoreMemory}
+	count := len(stores)
+	files := make([][]byte, count)
+	r := rand.New(rand.NewSource(1))
+	for i := range files {
+		files[i] = make([]byte, 1024*1024+i*4099)
+		r.Read(files[i])
+	}
+	modified := time.Now()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var i int
+		if _, e := fmt.Sscanf(req.URL.Path, `/%d.bin`, &i); e != nil || i < 0 || i >= len(files) {
+			http.NotFound(w, req)
+			return
+		}
+		http.ServeContent(w, req, req.URL.Path, modified, bytes.NewReader(files[i]))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	var wait sync.WaitGroup
+	errs := make([]error, count)
+	for i := 0; i < count; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			opts := NewOptions(fmt.Sprintf(`%s/%d.bin`, srv.URL, i))
+			opts.Dir = dir
+			opts.Worker = 4
+			opts.Block = 64 * 1024
+			opts.Store = stores[i]
+			errs[i] = Download(context.Background(), opts)
+		}(i)
+	}
+	wait.Wait()
+
+	for i := 0; i < count; i++ {
+		if errs[i] != nil {
+			t.Fatalf(`download %d: %v`, i, errs[i])
+		}
+		output := filepath.Join(dir, fmt.Sprintf(`%d.bin`, i))
+		b, e := os.ReadFile(output)
+		if e != nil {
+			t.Fatal(e)
+		} else if !bytes.Equal(b, files[i]) {
+			t.Fatalf(`%s not matched`, output)
+		}
+		matches, e := filepath.Glob(output + `.*`)
+		if e != nil {
+			t.Fatal(e)
+		} else if len(matches) != 0 {
+			t.Fatalf(`state of %s not removed: %v`, output, matches)
+		}
+	}
+}
+func TestDirs(t *testing.T) {
+	data := make([]byte, 512*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+	modified := time.Now()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, req.URL.Path, modified, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	opts := NewOptions(srv.URL + `/data.bin`)
+	opts.Output = filepath.Join(root, `output`, `data.bin`)
+	opts.TempDir = filepath.Join(root, `temp`)
+	opts.StateDir = filepath.Join(root, `state`)
+	opts.Worker = 4
+	opts.Block = 64 * 1024
+	e := Download(context.Background(), opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b, e := os.ReadFile(opts.Output)
+	if e != nil {
+		t.Fatal(e)
+	} else if !bytes.Equal(b, data) {
+		t.Fatalf(`%s not matched`, opts.Output)
+	}
+	for _, dir := range []string{opts.TempDir, opts.StateDir} {
+		entries, e := os.ReadDir(dir)
+		if e != nil {
+			t.Fatal(e)
+		} else if len(entries) != 0 {
+			t.Fatalf(`%s not empty`, dir)
+		}
+	}
+}
+func TestChecksumMismatch(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	modified := time.Now()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, req.URL.Path, modified, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	sum := sha256.Sum256(data)
+	wrong := sha256.Sum256(nil)
+	opts := NewOptions(srv.URL + `/data.bin`)
+	opts.Dir = t.TempDir()
+	opts.Worker = 4
+	opts.Block = 64 * 1024
+	opts.Checksum = `sha256:` + hex.EncodeToString(wrong[:])
+	e := Download(context.Background(), opts)
+	if e == nil {
+		t.Fatal(`checksum mismatch not reported`)
+	}
+	output := filepath.Join(opts.Dir, `data.bin`)
+	if _, e = os.Stat(output); !os.IsNotExist(e) {
+		t.Fatalf(`corrupted output %s: %v`, output, e)
+	}
+	matches, e := filepath.Glob(output + `.*`)
+	if e != nil {
+		t.Fatal(e)
+	} else if len(matches) == 0 {
+		t.Fatal(`state not kept`)
+	}
+
+	// the kept state is resumed
+	opts.Checksum = `sha256:` + hex.EncodeToString(sum[:])
+	e = Download(context.Background(), opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	b, e := os.ReadFile(output)
+	if e != nil {
+		t.Fatal(e)
+	} else if !bytes.Equal(b, data) {
+		t.Fatalf(`%s not matched`, output)
+	}
+}
+func TestRetry(t *testing.T) {
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	modified := time.Now()
+	var (
+		m     sync.Mutex
+		fails = make(map[string]int)
+		// failures of every range request
+		limit int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r := req.Header.Get(`Range`); r != `` && r != `bytes=0-0` {
+			m.Lock()
+			fail := fails[r] < limit
+			if fail {
+				fails[r]++
+			}
+			m.Unlock()
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		http.ServeContent(w, req, req.URL.Path, modified, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		retry int
+		limit int
+		ok    bool
+	}{
+		{2, 2, true},
+		{2, 3, false},
+	}
+	for _, test := range tests {
+		m.Lock()
+		fails = make(map[string]int)
+		limit = test.limit
+		m.Unlock()
+		opts := NewOptions(srv.URL + `/data.bin`)
+		opts.Dir = t.TempDir()
+		opts.Worker = 2
+		opts.Block = 64 * 1024
+		opts.Store = StoreMemory
+		opts.Retry = test.retry
+		opts.RetryWait = time.Millisecond * 10
+		opts.RetryMaxWait = time.Millisecond * 20
+		e := Download(context.Background(), opts)
+		if test.ok != (e == nil) {
+			t.Fatalf(`retry %v of %v failures: %v`, test.retry, test.limit, e)
+		} else if !test.ok {
+			continue
+		}
+		b, e := os.ReadFile(filepath.Join(opts.Dir, `data.bin`))
+		if e != nil {
+			t.Fatal(e)
+		} else if !bytes.Equal(b, data) {
+			t.Fatal(`data.bin not matched`)
+		}
+		m.Lock()
+		if len(fails) != len(data)/int(opts.Block) {
+			t.Errorf(`expected %v ranges failed got %v`, len(data)/int(opts.Block), len(fails))
+		}
+		m.Unlock()
+	}
+}
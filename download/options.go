@@ -0,0 +1,239 @@
+package download
+
+import (
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/checksum"
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+type (
+	// TLS is the tls options of the connections to the servers
+	TLS = metadata.TLS
+	// Transport is the options of the http connections, a zero duration is no timeout
+	Transport = metadata.Transport
+)
+
+const (
+	// StoreBolt stores the resume state in a bolt db <output>.db
+	StoreBolt = db.StoreBolt
+	// StoreJournal appends the changes of the resume state to <output>.journal without mmap or file locking
+	StoreJournal = db.StoreJournal
+	// StoreJSON writes the resume state to <output>.state.json for human inspection
+	StoreJSON = db.StoreJSON
+	// StoreMemory keeps the resume state in memory, the download cannot be resumed by another process
+	StoreMemory = db.StoreMemory
+)
+
+const (
+	MismatchAsk       = metadata.MismatchAsk
+	MismatchRestart   = metadata.MismatchRestart
+	MismatchKeepBlock = metadata.MismatchKeepBlock
+	MismatchAbort     = metadata.MismatchAbort
+)
+
+// CheckMismatch returns an error if mismatch is not ask restart keep-block or abort
+func CheckMismatch(mismatch string) error {
+	return metadata.CheckMismatch(mismatch)
+}
+
+// DefaultUserAgent is sent if UserAgent is empty
+var DefaultUserAgent = metadata.UserAgent
+
+// MaxWorkers returns the max number of workers of a download
+func MaxWorkers() int {
+	return metadata.MaxWorkers
+}
+
+// DefaultTransport returns the default options of the http connections
+func DefaultTransport() Transport {
+	return metadata.DefaultTransport()
+}
+
+// Options are the options of a download, NewOptions returns the defaults used by the command line
+type Options struct {
+	URL string
+	// urls which serve the same file as URL
+	Mirrors []string
+	// output file path, the default is the last element of the url path in the working directory
+	Output string
+	// relative Output is in the directory instead of the working directory
+	Dir string
+	// dir of the temp file which is moved to Output when finished, the default is beside Output.
+	// If it is on another file system the finished file is copied and synced to the disk.
+	TempDir string
+	// dir of the resume state, the default is beside Output
+	StateDir string
+	// allocate the blocks of the temp file before downloading so the disk cannot fill up while downloading, only supported on linux
+	Preallocate bool
+
+	// proxy url, if empty http_proxy https_proxy and all_proxy are used
+	Proxy     string
+	UserAgent string
+	// http request headers key: value
+	Header []string
+	// cookies are sent in turn by the requests
+	Cookie   []string
+	Insecure bool
+	TLS      TLS
+	// used instead of DefaultTransport if not zero
+	Transport Transport
+	// if set the connections are shared with other downloads, Proxy Insecure TLS and Transport are not used.
+	// The TLS ServerName of a client is only sent to the host of the download creating it.
+	Client *http.Client
+	// send HEAD request for the file meta information before download
+	Head bool
+
+	// number of workers, the initial number if AutoWorker is true
+	Worker int
+	// add or remove workers by the measured throughput
+	AutoWorker bool
+	Block      utils.Size
+	// abort and retry the block request if no byte is received in the duration, 0 is no timeout
+	StallTimeout time.Duration
+	// max retries of a failed request before the mirror is dropped or the download stops
+	Retry        int
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+	// bytes per second, 0 is unlimited
+	LimitRate       utils.Size
+	LimitRateWorker utils.Size
+
+	// verify the downloaded file, algorithm:hex or only the algorithm if ChecksumURL is set
+	Checksum string
+	// sidecar url of the expected checksum such as <url>.sha256 or SHA256SUMS
+	ChecksumURL string
+	// verify the hash of finished blocks when resuming
+	Verify bool
+	// download again from scratch if the file changed on the server while downloading
+	RestartChanged bool
+	// what to do if the downloaded data does not match the metadata when resuming, ask is abort unless it is answered by Downloader.SetMismatch
+	Mismatch string
+	// storage backend of the resume state, the default is StoreBolt
+	Store string
+
+	// write newline-delimited JSON progress events to a file, - for stdout or fd:N
+	Events string
+	// print the progress as plain text to stderr if UI is nil
+	Headless bool
+	// draws the progress, nothing is drawn if UI is nil and Headless is false
+	UI UI
+	// called with the progress every ProgressInterval and once after the download stops
+	OnProgress       func(Progress)
+	ProgressInterval time.Duration
+}
+
+// NewOptions returns the default options of the url
+func NewOptions(url string) *Options {
+	return &Options{
+		URL:          url,
+		Transport:    DefaultTransport(),
+		Worker:       runtime.NumCPU(),
+		Block:        utils.M * 5,
+		StallTimeout: time.Minute,
+		Retry:        5,
+		RetryWait:    time.Second,
+		RetryMaxWait: time.Minute,
+		Mismatch:     MismatchAbort,
+		Store:        StoreBolt,
+	}
+}
+
+// Check validates the options without creating a downloader, it returns the absolute path of the output file and true if the file already exists
+func (o *Options) Check() (output string, exists bool, e error) {
+	conf, e := o.configure()
+	if e != nil {
+		return
+	}
+	output = conf.Output
+	exists, e = conf.Exists()
+	return
+}
+func (o *Options) configure() (conf *metadata.Configure, e error) {
+	if o.Mismatch != `` {
+		e = metadata.CheckMismatch(o.Mismatch)
+		if e != nil {
+			return
+		}
+	}
+	store := o.Store
+	if store == `` {
+		store = StoreBolt
+	} else {
+		e = db.CheckStore(store)
+		if e != nil {
+			return
+		}
+	}
+	conf, e = metadata.NewConfigure(o.URL, o.Output, o.Proxy,
+		o.UserAgent, o.Head, o.Header, o.Cookie, o.Insecure,
+		o.Worker, o.Block,
+	)
+	if e != nil {
+		return
+	}
+	if o.Dir != `` && !filepath.IsAbs(o.Output) {
+		var dir string
+		dir, e = filepath.Abs(o.Dir)
+		if e != nil {
+			return
+		}
+		if o.Output == `` {
+			conf.Output = filepath.Join(dir, filepath.Base(conf.Output))
+		} else {
+			conf.Output = filepath.Join(dir, o.Output)
+		}
+	}
+	for _, mirror := range o.Mirrors {
+		e = conf.AddMirror(mirror)
+		if e != nil {
+			return
+		}
+	}
+	e = o.TLS.Check()
+	if e != nil {
+		return
+	}
+	conf.TLS = o.TLS
+	if o.Transport != (Transport{}) {
+		conf.Transport = o.Transport
+	}
+	if o.Client != nil {
+		conf.SetClient(o.Client)
+	}
+	conf.StallTimeout = o.StallTimeout
+	conf.AutoWorker = o.AutoWorker
+	conf.Retry, conf.RetryWait, conf.RetryMaxWait = o.Retry, o.RetryWait, o.RetryMaxWait
+	conf.LimitRate, conf.LimitRateWorker = o.LimitRate, o.LimitRateWorker
+	if o.Checksum != `` || o.ChecksumURL != `` {
+		conf.Checksum, e = checksum.Parse(o.Checksum, o.ChecksumURL)
+		if e != nil {
+			return
+		}
+	}
+	conf.Verify = o.Verify
+	conf.RestartChanged = o.RestartChanged
+	conf.Mismatch = o.Mismatch
+	conf.Store = store
+	if o.TempDir != `` {
+		conf.TempDir, e = filepath.Abs(o.TempDir)
+		if e != nil {
+			return
+		}
+	}
+	conf.Preallocate = o.Preallocate
+	if o.StateDir != `` {
+		conf.StateDir, e = filepath.Abs(o.StateDir)
+		if e != nil {
+			return
+		}
+	}
+	conf.Events = o.Events
+	conf.Headless = o.Headless
+	return
+}
@@ -6,5 +6,8 @@ require (
 	github.com/boltdb/bolt v1.3.1
 	github.com/jroimartin/gocui v0.5.0
 	github.com/spf13/cobra v1.2.1
+	github.com/spf13/pflag v1.0.5
 	golang.org/x/net v0.0.0-20211123203042-d83791d6bcd9
+	golang.org/x/term v0.0.0-20210503060354-a79de5458b56
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,190 @@
+package checksum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	net_url "net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+var algorithms = []string{`sha512`, `sha256`, `sha1`, `md5`}
+
+type Checksum struct {
+	Algorithm string
+	// expected digest, empty when it is read from URL
+	Sum []byte
+	// sidecar file such as <url>.sha256 or SHA256SUMS
+	URL string
+}
+
+// Parse parses algorithm:hex, if url is not empty str may be only the algorithm or empty
+func Parse(str, url string) (c *Checksum, e error) {
+	var algorithm, sum string
+	strs := strings.SplitN(str, `:`, 2)
+	algorithm = strings.ToLower(strings.TrimSpace(strs[0]))
+	if len(strs) == 2 {
+		sum = strings.TrimSpace(strs[1])
+	}
+	if algorithm == `` {
+		if url == `` {
+			e = fmt.Errorf(`invalid checksum: %s`, str)
+			return
+		}
+		algorithm = guessAlgorithm(url)
+		if algorithm == `` {
+			e = fmt.Errorf(`unknown checksum algorithm of %s`, url)
+			return
+		}
+	}
+	h, e := New(algorithm)
+	if e != nil {
+		return
+	}
+	c = &Checksum{
+		Algorithm: algorithm,
+		URL:       url,
+	}
+	if url == `` {
+		if sum == `` {
+			e = fmt.Errorf(`invalid checksum: %s`, str)
+			return
+		}
+		c.Sum, e = hex.DecodeString(sum)
+		if e != nil {
+			e = fmt.Errorf(`invalid checksum %s: %w`, str, e)
+			return
+		} else if len(c.Sum) != h.Size() {
+			e = fmt.Errorf(`invalid %s checksum length: %s`, algorithm, sum)
+			return
+		}
+	} else if sum != `` {
+		e = fmt.Errorf(`checksum digest and url cannot be used together: %s`, str)
+		return
+	}
+	return
+}
+
+// guessAlgorithm returns the algorithm by the extension of the sidecar such as .sha256 or .sha256sum,
+// or by the name such as SHA256SUMS, empty if it is unknown
+func guessAlgorithm(url string) string {
+	if u, e := net_url.Parse(url); e == nil {
+		url = u.Path
+	}
+	name := strings.ToLower(path.Base(url))
+	ext := strings.TrimPrefix(path.Ext(name), `.`)
+	stem := strings.TrimSuffix(name, `.txt`)
+	for _, v := range algorithms {
+		if ext == v || ext == v+`sum` ||
+			stem == v+`sums` || stem == v+`sum` {
+			return v
+		}
+	}
+	return ``
+}
+func New(algorithm string) (h hash.Hash, e error) {
+	switch algorithm {
+	case `md5`:
+		h = md5.New()
+	case `sha1`:
+		h = sha1.New()
+	case `sha256`:
+		h = sha256.New()
+	case `sha512`:
+		h = sha512.New()
+	default:
+		e = fmt.Errorf(`not supported checksum algorithm: %s`, algorithm)
+	}
+	return
+}
+func (c *Checksum) String() string {
+	if c.URL != `` && len(c.Sum) == 0 {
+		return c.Algorithm + `:` + c.URL
+	}
+	return c.Algorithm + `:` + hex.EncodeToString(c.Sum)
+}
+
+// ReadSidecar reads the digest of name from a sidecar file.
+//
+// It supports a single digest, the coreutils format '<hex>  name' and the bsd format 'SHA256 (name) = <hex>'.
+func (c *Checksum) ReadSidecar(r io.Reader, name string) (e error) {
+	h, e := New(c.Algorithm)
+	if e != nil {
+		return
+	}
+	var (
+		size    = h.Size() * 2
+		scanner = bufio.NewScanner(r)
+		single  string
+		lines   int
+	)
+	for scanner.Scan() {
+		str := strings.TrimSpace(scanner.Text())
+		if str == `` || strings.HasPrefix(str, `#`) {
+			continue
+		}
+		lines++
+		var sum, file string
+		if i := strings.LastIndex(str, `) = `); i > 0 && strings.Contains(str[:i], ` (`) {
+			file = str[strings.Index(str, ` (`)+2 : i]
+			sum = strings.TrimSpace(str[i+len(`) = `):])
+		} else {
+			strs := strings.SplitN(str, ` `, 2)
+			sum = strs[0]
+			if len(strs) == 2 {
+				file = strings.TrimPrefix(strings.TrimSpace(strs[1]), `*`)
+			}
+		}
+		if len(sum) != size {
+			continue
+		}
+		if file == `` {
+			single = sum
+		} else if file == name || path.Base(file) == name {
+			c.Sum, e = hex.DecodeString(sum)
+			return
+		}
+	}
+	e = scanner.Err()
+	if e != nil {
+		return
+	}
+	if single != `` && lines == 1 {
+		c.Sum, e = hex.DecodeString(single)
+		return
+	}
+	e = fmt.Errorf(`%s checksum of %s not found in %s`, c.Algorithm, name, c.URL)
+	return
+}
+
+// Verify computes the digest of filename and compares it with the expected digest
+func (c *Checksum) Verify(filename string) (e error) {
+	h, e := New(c.Algorithm)
+	if e != nil {
+		return
+	}
+	f, e := os.Open(filename)
+	if e != nil {
+		return
+	}
+	_, e = io.Copy(h, f)
+	f.Close()
+	if e != nil {
+		return
+	}
+	sum := h.Sum(nil)
+	if !bytes.Equal(sum, c.Sum) {
+		e = fmt.Errorf(`checksum mismatch: %s expected %s got %s`, c.Algorithm, hex.EncodeToString(c.Sum), hex.EncodeToString(sum))
+		return
+	}
+	return
+}
@@ -0,0 +1,116 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestGuessAlgorithm(t *testing.T) {
+	tests := []struct {
+		url       string
+		algorithm string
+	}{
+		{`http://127.0.0.1/tools/source.exe.sha256`, `sha256`},
+		{`http://127.0.0.1/tools/source.exe.SHA512`, `sha512`},
+		{`http://127.0.0.1/tools/source.exe.md5`, `md5`},
+		{`http://127.0.0.1/tools/source.exe.sha1sum`, `sha1`},
+		{`http://127.0.0.1/tools/SHA256SUMS`, `sha256`},
+		{`http://127.0.0.1/tools/MD5SUMS`, `md5`},
+		{`http://127.0.0.1/tools/sha512sums.txt`, `sha512`},
+		{`http://127.0.0.1/tools/sha256sum.txt`, `sha256`},
+		{`http://127.0.0.1/tools/sha1-tools.sha256`, `sha256`},
+		{`http://127.0.0.1/tools/md5-sha1.sha512?token=sha1`, `sha512`},
+		{`http://127.0.0.1/tools/sha512-tools.sha1`, `sha1`},
+		{`http://127.0.0.1/sha256/checksums.txt`, ``},
+		{`http://127.0.0.1/tools/sha256-tools.txt`, ``},
+		{`http://127.0.0.1/tools/source.exe`, ``},
+	}
+	for _, test := range tests {
+		if algorithm := guessAlgorithm(test.url); algorithm != test.algorithm {
+			t.Errorf(`guess %s: expected %q got %q`, test.url, test.algorithm, algorithm)
+		}
+	}
+}
+func TestParse(t *testing.T) {
+	sum := sha256.Sum256([]byte(`mget`))
+	digest := hex.EncodeToString(sum[:])
+	tests := []struct {
+		str, url  string
+		algorithm string
+		err       bool
+	}{
+		{`sha256:` + digest, ``, `sha256`, false},
+		{`SHA256: ` + strings.ToUpper(digest), ``, `sha256`, false},
+		{`sha512:` + digest, ``, ``, true},
+		{`sha256:` + digest[1:], ``, ``, true},
+		{`sha256:xyz`, ``, ``, true},
+		{`sha256`, ``, ``, true},
+		{`crc32:` + digest, ``, ``, true},
+		{``, ``, ``, true},
+		{`sha256`, `http://127.0.0.1/SHA256SUMS`, `sha256`, false},
+		{``, `http://127.0.0.1/source.exe.md5`, `md5`, false},
+		{``, `http://127.0.0.1/sha1-tools.sha256`, `sha256`, false},
+		{``, `http://127.0.0.1/checksums.txt`, ``, true},
+		{`sha256:` + digest, `http://127.0.0.1/SHA256SUMS`, ``, true},
+	}
+	for _, test := range tests {
+		c, e := Parse(test.str, test.url)
+		if test.err {
+			if e == nil {
+				t.Errorf(`parse %q %q: expected error`, test.str, test.url)
+			}
+			continue
+		} else if e != nil {
+			t.Errorf(`parse %q %q: %v`, test.str, test.url, e)
+			continue
+		}
+		if c.Algorithm != test.algorithm {
+			t.Errorf(`parse %q %q: expected %s got %s`, test.str, test.url, test.algorithm, c.Algorithm)
+		}
+		if test.url == `` && hex.EncodeToString(c.Sum) != digest {
+			t.Errorf(`parse %q: sum not matched`, test.str)
+		}
+	}
+}
+func TestReadSidecar(t *testing.T) {
+	sum := sha256.Sum256([]byte(`mget`))
+	digest := hex.EncodeToString(sum[:])
+	other := strings.Repeat(`0`, len(digest))
+	tests := []struct {
+		name    string
+		sidecar string
+		found   bool
+	}{
+		{`single`, digest + "\n", true},
+		{`single without newline`, digest, true},
+		{`coreutils`, other + "  other.exe\n" + digest + "  source.exe\n", true},
+		{`coreutils binary`, other + " *other.exe\n" + digest + " *source.exe\n", true},
+		{`coreutils path`, digest + "  ./dist/source.exe\n", true},
+		{`bsd`, `SHA256 (other.exe) = ` + other + "\nSHA256 (source.exe) = " + digest + "\n", true},
+		{`comments`, "# checksums\n\n" + digest + "  source.exe\n", true},
+		{`crlf`, digest + "  source.exe\r\n", true},
+		{`not found`, other + "  other.exe\n", false},
+		{`single of several lines`, digest + "\n" + other + "\n", false},
+		{`other length`, digest[:40] + "  source.exe\n", false},
+		{`empty`, ``, false},
+	}
+	for _, test := range tests {
+		c := &Checksum{
+			Algorithm: `sha256`,
+			URL:       `http://127.0.0.1/SHA256SUMS`,
+		}
+		e := c.ReadSidecar(strings.NewReader(test.sidecar), `source.exe`)
+		if !test.found {
+			if e == nil {
+				t.Errorf(`%s: expected error`, test.name)
+			}
+			continue
+		} else if e != nil {
+			t.Errorf(`%s: %v`, test.name, e)
+		} else if hex.EncodeToString(c.Sum) != digest {
+			t.Errorf(`%s: expected %s got %x`, test.name, digest, c.Sum)
+		}
+	}
+}
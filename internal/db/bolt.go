@@ -0,0 +1,189 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+var (
+	BucketMetadata = []byte(`Metadata`)
+	BucketTask     = []byte(`Task`)
+	BucketHash     = []byte(`Hash`)
+	// Split stores the offset and the num of the tasks changed by splitting
+	BucketSplit = []byte(`Split`)
+)
+
+var keyMetadata = []byte(`md`)
+
+// boltStore stores the state in a bolt db, it needs mmap and file locking
+type boltStore struct {
+	*bolt.DB
+}
+
+func openBolt(filename string) (s *boltStore, e error) {
+	d, e := bolt.Open(filename, 0600, &bolt.Options{Timeout: time.Second})
+	if e != nil {
+		e = fmt.Errorf(`open db %s-> %w`, filename, e)
+		return
+	}
+	// the db of an old version has no Hash and Split
+	e = d.Update(func(t *bolt.Tx) (e error) {
+		for _, name := range [][]byte{BucketTask, BucketHash, BucketSplit} {
+			_, e = t.CreateBucketIfNotExists(name)
+			if e != nil {
+				return
+			}
+		}
+		return
+	})
+	if e != nil {
+		d.Close()
+		return
+	}
+	s = &boltStore{DB: d}
+	return
+}
+
+// readBolt returns the metadata stored in the bolt db, it does not lock the db for writing
+func readBolt(filename string) (md *Metadata, e error) {
+	d, e := bolt.Open(filename, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if e != nil {
+		e = fmt.Errorf(`open db %s-> %w`, filename, e)
+		return
+	}
+	defer d.Close()
+	e = d.View(func(t *bolt.Tx) (e error) {
+		md, e = getMetadata(t)
+		return
+	})
+	return
+}
+func getMetadata(t *bolt.Tx) (md *Metadata, e error) {
+	bucket := t.Bucket(BucketMetadata)
+	if bucket == nil {
+		return
+	}
+	val := bucket.Get(keyMetadata)
+	if val == nil {
+		return
+	}
+	md = &Metadata{}
+	e = md.Unmarshal(val)
+	if e != nil {
+		md = nil
+	}
+	return
+}
+func putMetadata(t *bolt.Tx, md *Metadata) (e error) {
+	bucket, e := t.CreateBucketIfNotExists(BucketMetadata)
+	if e != nil {
+		return
+	}
+	val, e := md.Marshal()
+	if e != nil {
+		return
+	}
+	return bucket.Put(keyMetadata, val)
+}
+func (s *boltStore) Metadata() (md *Metadata, e error) {
+	e = s.View(func(t *bolt.Tx) (e error) {
+		md, e = getMetadata(t)
+		return
+	})
+	return
+}
+func (s *boltStore) Init(md *Metadata) error {
+	return s.Update(func(t *bolt.Tx) (e error) {
+		for _, name := range [][]byte{BucketTask, BucketHash, BucketSplit} {
+			e = t.DeleteBucket(name)
+			if e != nil && e != bolt.ErrBucketNotFound {
+				return
+			}
+			_, e = t.CreateBucket(name)
+			if e != nil {
+				return
+			}
+		}
+		return putMetadata(t, md)
+	})
+}
+func (s *boltStore) SetMetadata(md *Metadata) error {
+	return s.Update(func(t *bolt.Tx) error {
+		return putMetadata(t, md)
+	})
+}
+func (s *boltStore) GetSize(id int64) (size utils.Size, e error) {
+	e = s.View(func(t *bolt.Tx) (e error) {
+		size = utils.Size(utils.Btoi(t.Bucket(BucketTask).Get(utils.Itob(id))))
+		return
+	})
+	return
+}
+func (s *boltStore) GetHash(id int64) (hash []byte, e error) {
+	e = s.View(func(t *bolt.Tx) (e error) {
+		val := t.Bucket(BucketHash).Get(utils.Itob(id))
+		if val != nil {
+			hash = make([]byte, len(val))
+			copy(hash, val)
+		}
+		return
+	})
+	return
+}
+func (s *boltStore) Put(batch map[int64]Batch) error {
+	return s.Update(func(t *bolt.Tx) (e error) {
+		var (
+			bucket = t.Bucket(BucketTask)
+			hash   = t.Bucket(BucketHash)
+		)
+		for k, v := range batch {
+			key := utils.Itob(k)
+			e = bucket.Put(key, utils.Itob(v.Val))
+			if e != nil {
+				break
+			}
+			if v.Hash != nil {
+				e = hash.Put(key, v.Hash)
+				if e != nil {
+					break
+				}
+			}
+		}
+		return
+	})
+}
+func (s *boltStore) Splits() (tasks []*Task, e error) {
+	e = s.View(func(t *bolt.Tx) error {
+		return t.Bucket(BucketSplit).ForEach(func(k, v []byte) error {
+			if len(v) != 16 {
+				return fmt.Errorf(`invalid split: %v`, v)
+			}
+			tasks = append(tasks, &Task{
+				ID:     utils.Btoi(k),
+				Offset: utils.Size(utils.Btoi(v[:8])),
+				Num:    utils.Size(utils.Btoi(v[8:])),
+			})
+			return nil
+		})
+	})
+	return
+}
+func (s *boltStore) Split(tasks ...*Task) error {
+	return s.Update(func(tx *bolt.Tx) (e error) {
+		bucket := tx.Bucket(BucketSplit)
+		for _, t := range tasks {
+			val := append(utils.Itob(int64(t.Offset)), utils.Itob(int64(t.Num))...)
+			e = bucket.Put(utils.Itob(t.ID), val)
+			if e != nil {
+				break
+			}
+		}
+		return
+	})
+}
+func (s *boltStore) Sync() error {
+	return nil
+}
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"bytes"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// NewHash returns the hash stored for every finished block
+func NewHash() hash.Hash32 {
+	return crc32.New(castagnoli)
+}
+
+type Batch struct {
+	ID  int64
+	Val int64
+	// hash of the finished block, written in the same transaction as Val
+	Hash []byte
+}
+
+type DB struct {
+	store Store
+	// file of the stored state, empty if it is not stored in a file
+	Filename string
+	Temp     string
+	Output   string
+	ch       chan Batch
+	flush    chan chan struct{}
+	close    chan struct{}
+	wait     sync.WaitGroup
+	once     sync.Once
+}
+
+// OpenDB opens the state of the files, the dirs of the files are created if they do not exist
+func OpenDB(files Files) (result *DB, e error) {
+	log.Trace(`open db: `, files.Store, ` `, files.State)
+	e = files.Mkdir()
+	if e != nil {
+		return
+	}
+	s, e := openStore(files.Store, files.State)
+	if e != nil {
+		return
+	}
+	result = &DB{
+		store:    s,
+		Filename: files.State,
+		Output:   files.Output,
+		Temp:     files.Temp,
+		ch:       make(chan Batch, runtime.NumCPU()*4),
+		flush:    make(chan chan struct{}),
+		close:    make(chan struct{}),
+	}
+	result.wait.Add(1)
+	go result.batch()
+	return
+}
+
+// ReadMetadata returns the metadata stored for the files, nil if nothing is stored
+func ReadMetadata(files Files) (md *Metadata, e error) {
+	if files.State == `` {
+		return
+	} else if _, e = os.Stat(files.State); e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	switch files.Store {
+	case StoreBolt:
+		md, e = readBolt(files.State)
+	case StoreJournal:
+		md, e = readJournal(files.State)
+	case StoreJSON:
+		md, e = readJSON(files.State)
+	}
+	return
+}
+func (d *DB) Finish() (e error) {
+	e = MoveFile(d.Temp, d.Output)
+	if e != nil {
+		return
+	}
+	d.Close()
+	if d.Filename != `` {
+		os.Remove(d.Filename)
+	}
+	return
+}
+
+// Remove closes the db and removes the stored state and the temp file
+func (d *DB) Remove() (e error) {
+	e = d.Close()
+	if e != nil {
+		return
+	}
+	if d.Filename != `` {
+		e = os.Remove(d.Filename)
+		if e != nil && !os.IsNotExist(e) {
+			return
+		}
+	}
+	e = os.Remove(d.Temp)
+	if os.IsNotExist(e) {
+		e = nil
+	}
+	return
+}
+
+// Flush waits until the pending batch is written
+func (d *DB) Flush() {
+	done := make(chan struct{})
+	select {
+	case d.flush <- done:
+		<-done
+	case <-d.close:
+	}
+}
+
+// Close writes the pending batch and closes the db
+func (d *DB) Close() (e error) {
+	d.once.Do(func() {
+		close(d.close)
+		d.wait.Wait()
+		e = d.store.Close()
+	})
+	return
+}
+func (d *DB) Load(size, block utils.Size, modified, etag string) (e error) {
+	log.Trace(`load db`)
+	current := &Metadata{
+		Size:     size,
+		Block:    block,
+		Modified: modified,
+		ETag:     etag,
+	}
+	md, e := d.store.Metadata()
+	if e != nil {
+		return
+	} else if md == nil {
+		e = d.truncate(d.Temp, int64(size))
+		if e != nil {
+			return
+		}
+		e = d.store.Init(current)
+		if e != nil {
+			return
+		}
+		log.Info(`new metadata`)
+		return
+	}
+	if len(md.Diff(current)) != 0 {
+		e = &MismatchError{
+			Stored:  *md,
+			Current: *current,
+		}
+		return
+	}
+	log.Info(`metadata matched`)
+	if md.ETag != etag {
+		md.ETag = etag
+		e = d.store.SetMetadata(md)
+	}
+	return
+}
+func (d *DB) truncate(filename string, size int64) (e error) {
+	f, e := os.Create(filename)
+	if e != nil {
+		return
+	}
+	e = f.Truncate(size)
+	f.Close()
+	if e != nil {
+		os.Remove(filename)
+	}
+	return
+}
+
+// Tasks returns the tasks of the file ordered by offset, tasks of block size are changed by the stored splits
+func (d *DB) Tasks(size, block utils.Size) (tasks []*Task, e error) {
+	var (
+		offset, num utils.Size
+		id          int64
+	)
+	for offset < size {
+		id++
+		if offset+block > size {
+			num = size - offset
+		} else {
+			num = block
+		}
+		tasks = append(tasks, &Task{
+			ID:     id,
+			Offset: offset,
+			Num:    num,
+		})
+		offset += num
+	}
+	splits, e := d.store.Splits()
+	if e != nil {
+		return
+	}
+	for _, task := range splits {
+		if task.ID > 0 && task.ID <= id {
+			tasks[task.ID-1] = task
+		} else {
+			tasks = append(tasks, task)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].Offset < tasks[j].Offset
+	})
+	return
+}
+
+// Split stores the shrunk task and the task split from it
+func (d *DB) Split(t, split *Task) error {
+	return d.store.Split(t, split)
+}
+func (d *DB) GetSize(id int64) (utils.Size, error) {
+	return d.store.GetSize(id)
+}
+func (d *DB) SetSize(id, size int64) (e error) {
+	d.ch <- Batch{
+		ID:  id,
+		Val: size,
+	}
+	return
+}
+
+// SetFinish records the size and the hash of a finished block
+func (d *DB) SetFinish(id, size int64, hash []byte) (e error) {
+	d.ch <- Batch{
+		ID:   id,
+		Val:  size,
+		Hash: hash,
+	}
+	return
+}
+func (d *DB) GetHash(id int64) ([]byte, error) {
+	return d.store.GetHash(id)
+}
+
+// HashBlock returns the hash of n bytes at offset of the temp file
+func (d *DB) HashBlock(offset, n int64) (h hash.Hash32, e error) {
+	if n == 0 {
+		h = NewHash()
+		return
+	}
+	f, e := os.Open(d.Temp)
+	if e != nil {
+		return
+	}
+	h = NewHash()
+	_, e = io.Copy(h, io.NewSectionReader(f, offset, n))
+	f.Close()
+	return
+}
+
+// VerifyBlock checks the finished block against the stored hash, a block without hash is trusted and its hash is stored
+func (d *DB) VerifyBlock(t *Task) (ok bool, e error) {
+	expected, e := d.GetHash(t.ID)
+	if e != nil {
+		return
+	}
+	num := t.Len()
+	h, e := d.HashBlock(int64(t.Offset), int64(num))
+	if e != nil {
+		return
+	}
+	sum := h.Sum(nil)
+	if expected == nil {
+		ok = true
+		e = d.SetFinish(t.ID, int64(num), sum)
+		return
+	}
+	ok = bytes.Equal(expected, sum)
+	return
+}
+func (d *DB) batch() {
+	defer d.wait.Done()
+	m := make(map[int64]Batch)
+	for {
+		exit, flushed := d.getBatch(m)
+		if len(m) != 0 {
+			d.putBatch(m)
+			for k := range m {
+				delete(m, k)
+			}
+		}
+		if flushed != nil {
+			e := d.store.Sync()
+			if e != nil {
+				log.Error(`save state: `, e)
+			}
+			close(flushed)
+		}
+		if exit {
+			break
+		}
+	}
+}
+func (d *DB) putBatch(m map[int64]Batch) {
+	e := d.store.Put(m)
+	if e != nil {
+		log.Error(`save state: `, e)
+	}
+}
+func (d *DB) getBatch(m map[int64]Batch) (exit bool, flushed chan struct{}) {
+	var node Batch
+	select {
+	case node = <-d.ch:
+	case flushed = <-d.flush:
+		d.drainBatch(m)
+		return
+	case <-d.close:
+		exit = true
+		d.drainBatch(m)
+		return
+	}
+
+	m[node.ID] = node
+	for {
+		select {
+		case node = <-d.ch:
+			m[node.ID] = node
+		case flushed = <-d.flush:
+			d.drainBatch(m)
+			return
+		case <-d.close:
+			exit = true
+			d.drainBatch(m)
+			return
+		default:
+			return
+		}
+	}
+}
+func (d *DB) drainBatch(m map[int64]Batch) {
+	for {
+		select {
+		case node := <-d.ch:
+			m[node.ID] = node
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+var errPreallocate = errors.New(`preallocation is not supported on ` + runtime.GOOS)
+
+// SpaceError is returned when the file system does not have the free space to finish the download
+type SpaceError struct {
+	Dir  string
+	Need utils.Size
+	Free utils.Size
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf(`not enough free space in %s, need %s free %s`, e.Dir, e.Need, e.Free)
+}
+
+// IsNoSpace returns true if e is caused by a full disk
+func IsNoSpace(e error) bool {
+	var se *SpaceError
+	if errors.As(e, &se) {
+		return true
+	}
+	var errno syscall.Errno
+	if !errors.As(e, &errno) {
+		return false
+	}
+	// ERROR_HANDLE_DISK_FULL ERROR_DISK_FULL
+	return errno == syscall.ENOSPC || (runtime.GOOS == `windows` && (errno == 39 || errno == 112))
+}
+
+// CheckSpace returns a SpaceError if the file systems do not have the free space to finish the download of size.
+// The blocks already allocated by the temp file are not needed again, free space which cannot be read is not checked.
+func (f *Files) CheckSpace(size utils.Size) (e error) {
+	dir := filepath.Dir(f.Temp)
+	need := int64(size)
+	if info, err := os.Stat(f.Temp); err == nil {
+		need -= allocated(info)
+	}
+	e = checkFree(dir, need)
+	if e != nil {
+		return
+	}
+	output := filepath.Dir(f.Output)
+	if !sameDevice(dir, output) {
+		// the finished file is copied to the output
+		e = checkFree(output, int64(size))
+	}
+	return
+}
+func checkFree(dir string, need int64) error {
+	if need <= 0 {
+		return nil
+	}
+	free, ok := freeSpace(dir)
+	if ok && need > free {
+		return &SpaceError{
+			Dir:  dir,
+			Need: utils.Size(need),
+			Free: utils.Size(free),
+		}
+	}
+	return nil
+}
+
+// Preallocate allocates the blocks of the temp file so writing it cannot fail because the disk is full.
+// The written data is kept, if the file system does not support it the temp file stays sparse.
+func (d *DB) Preallocate(size utils.Size) (e error) {
+	f, e := os.OpenFile(d.Temp, os.O_WRONLY, 0666)
+	if e != nil {
+		return
+	}
+	e = fallocate(f, int64(size))
+	f.Close()
+	if e == errPreallocate || errors.Is(e, syscall.EOPNOTSUPP) {
+		log.Info(`preallocation is not supported, the temp file is sparse: `, e)
+		e = nil
+	} else if e == nil {
+		log.Info(`preallocate `, utils.Size(size), ` `, d.Temp)
+	}
+	return
+}
@@ -0,0 +1,19 @@
+//go:build !darwin && !freebsd && !linux && !windows
+// +build !darwin,!freebsd,!linux,!windows
+
+package db
+
+import (
+	"os"
+)
+
+// freeSpace is not supported, the free space is not checked
+func freeSpace(dir string) (free int64, ok bool) {
+	return
+}
+func allocated(info os.FileInfo) int64 {
+	return info.Size()
+}
+func sameDevice(a, b string) bool {
+	return true
+}
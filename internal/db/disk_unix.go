@@ -0,0 +1,33 @@
+//go:build darwin || freebsd || linux
+// +build darwin freebsd linux
+
+package db
+
+import (
+	"os"
+	"syscall"
+)
+
+// freeSpace returns the bytes available to the user in the file system of dir
+func freeSpace(dir string) (free int64, ok bool) {
+	var st syscall.Statfs_t
+	if syscall.Statfs(dir, &st) != nil {
+		return
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), true
+}
+
+// allocated returns the bytes allocated on the disk by the file, a sparse file allocates less than its size
+func allocated(info os.FileInfo) int64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int64(st.Blocks) * 512
+	}
+	return info.Size()
+}
+func sameDevice(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return true
+	}
+	return uint64(sa.Dev) == uint64(sb.Dev)
+}
@@ -0,0 +1,33 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL(`kernel32.dll`).NewProc(`GetDiskFreeSpaceExW`)
+
+// freeSpace returns the bytes available to the user in the file system of dir
+func freeSpace(dir string) (free int64, ok bool) {
+	p, e := syscall.UTF16PtrFromString(dir)
+	if e != nil {
+		return
+	}
+	var available uint64
+	r, _, _ := procGetDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if r == 0 {
+		return
+	}
+	return int64(available), true
+}
+
+// allocated returns the size of the file, the truncated file is not sparse on windows
+func allocated(info os.FileInfo) int64 {
+	return info.Size()
+}
+func sameDevice(a, b string) bool {
+	return strings.EqualFold(filepath.VolumeName(a), filepath.VolumeName(b))
+}
@@ -0,0 +1,15 @@
+package db
+
+import (
+	"os"
+	"syscall"
+)
+
+func fallocate(f *os.File, size int64) (e error) {
+	for {
+		e = syscall.Fallocate(int(f.Fd()), 0, 0, size)
+		if e != syscall.EINTR {
+			return
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package db
+
+import (
+	"os"
+)
+
+func fallocate(f *os.File, size int64) error {
+	return errPreallocate
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/zuiwuchang/mget/internal/log"
+)
+
+// Files are the paths of the files used to download Output
+type Files struct {
+	Output string
+	// the downloaded data is written to Temp and moved to Output when it is finished
+	Temp string
+	// file of the stored state, empty if the state is not stored in a file
+	State string
+	Store string
+}
+
+// NewFiles returns the files of output, the temp file and the state are beside output if the dir is empty.
+// The name of the file in another dir contains the hash of output so outputs of the same name in different dirs do not conflict.
+func NewFiles(output, store, tempDir, stateDir string) Files {
+	f := Files{
+		Output: output,
+		Temp:   filename(output, tempDir, `tmp`),
+		Store:  store,
+	}
+	switch store {
+	case StoreBolt:
+		f.State = filename(output, stateDir, `db`)
+	case StoreJournal:
+		f.State = filename(output, stateDir, `journal`)
+	case StoreJSON:
+		f.State = filename(output, stateDir, `state.json`)
+	}
+	return f
+}
+func filename(output, dir, ext string) string {
+	name := output
+	if dir != `` {
+		sum := sha1.Sum([]byte(output))
+		name = filepath.Join(dir, filepath.Base(output)+`.`+hex.EncodeToString(sum[:4]))
+	}
+	if strings.HasSuffix(name, `.`) {
+		return name + ext
+	}
+	return name + `.` + ext
+}
+
+// Mkdir creates the dirs of the files, the dir of Output is also created so the finished file can be moved
+func (f *Files) Mkdir() (e error) {
+	for _, name := range []string{f.Output, f.Temp, f.State} {
+		if name == `` {
+			continue
+		}
+		e = os.MkdirAll(filepath.Dir(name), 0755)
+		if e != nil {
+			return
+		}
+	}
+	return
+}
+
+// MoveFile renames src to dst, if they are on different file systems src is copied, synced to the disk and removed
+func MoveFile(src, dst string) (e error) {
+	e = os.Rename(src, dst)
+	if e == nil || !isCrossDevice(e) {
+		return
+	}
+	log.Info(`copy `, src, ` to `, dst, ` across file systems`)
+	e = copyFile(src, dst)
+	if e != nil {
+		return
+	}
+	return os.Remove(src)
+}
+
+// isCrossDevice returns true if rename failed because the paths are on different file systems
+func isCrossDevice(e error) bool {
+	var errno syscall.Errno
+	if !errors.As(e, &errno) {
+		return false
+	}
+	// ERROR_NOT_SAME_DEVICE
+	return errno == syscall.EXDEV || (runtime.GOOS == `windows` && errno == 17)
+}
+
+// copyFile copies src to a temp file beside dst and renames it to dst, so dst is never a partial file
+func copyFile(src, dst string) (e error) {
+	r, e := os.Open(src)
+	if e != nil {
+		return
+	}
+	defer r.Close()
+	info, e := r.Stat()
+	if e != nil {
+		return
+	}
+	w, e := os.CreateTemp(filepath.Dir(dst), `.`+filepath.Base(dst)+`.*`)
+	if e != nil {
+		return
+	}
+	temp := w.Name()
+	_, e = io.Copy(w, r)
+	if e == nil {
+		e = w.Chmod(info.Mode())
+	}
+	if e == nil {
+		e = w.Sync()
+	}
+	if err := w.Close(); e == nil {
+		e = err
+	}
+	if e == nil {
+		e = os.Rename(temp, dst)
+	}
+	if e != nil {
+		os.Remove(temp)
+	}
+	return
+}
@@ -0,0 +1,358 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// types of the journal records
+const (
+	recordMetadata = 'M'
+	recordSize     = 'S'
+	recordHash     = 'H'
+	recordSplit    = 'P'
+)
+
+// compactRecords is the number of records which can be appended more than the stored values before the journal is rewritten
+const compactRecords = 4096
+
+// journalSyncInterval is the min interval of syncing the journal by Put
+const journalSyncInterval = time.Second
+
+var errRecord = errors.New(`invalid journal record`)
+
+// journal appends every change of the state to a file without mmap or locking, the state is replayed on open.
+// A record is type, uvarint length of the payload, payload and the crc32 of type and payload.
+// The sizes written by Put are synced at most once every journalSyncInterval, a crash loses only the progress of the interval which is downloaded again.
+// The metadata and the splits are synced at once.
+type journal struct {
+	memory
+	filename string
+	f        *os.File
+	buf      []byte
+	records  int
+	synced   time.Time
+	dirty    bool
+}
+
+func openJournal(filename string) (s *journal, e error) {
+	s = &journal{
+		filename: filename,
+	}
+	s.reset(nil)
+	f, e := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	if e != nil {
+		s = nil
+		return
+	}
+	valid, e := s.replay(f)
+	if e == nil {
+		// drop the record torn by a crash
+		e = f.Truncate(valid)
+	}
+	if e == nil {
+		_, e = f.Seek(valid, io.SeekStart)
+	}
+	if e != nil {
+		f.Close()
+		s = nil
+		return
+	}
+	s.f = f
+	if s.records > s.entries()+compactRecords {
+		e = s.compact()
+		if e != nil {
+			s.f.Close()
+			s = nil
+		}
+	}
+	return
+}
+
+// readJournal returns the metadata stored in the journal without changing the file
+func readJournal(filename string) (md *Metadata, e error) {
+	f, e := os.Open(filename)
+	if e != nil {
+		return
+	}
+	defer f.Close()
+	s := &journal{}
+	s.reset(nil)
+	_, e = s.replay(f)
+	if e != nil {
+		return
+	}
+	md = s.md
+	return
+}
+
+// replay applies the records and returns the size of the valid records
+func (s *journal) replay(f *os.File) (valid int64, e error) {
+	r := bufio.NewReader(f)
+	for {
+		var n int
+		n, e = s.read(r)
+		if e != nil {
+			if e == io.EOF || e == io.ErrUnexpectedEOF || e == errRecord {
+				e = nil
+			}
+			return
+		}
+		valid += int64(n)
+		s.records++
+	}
+}
+func (s *journal) read(r *bufio.Reader) (n int, e error) {
+	t, e := r.ReadByte()
+	if e != nil {
+		return
+	}
+	length, e := binary.ReadUvarint(r)
+	if e != nil {
+		return
+	} else if length > utils.M {
+		e = errRecord
+		return
+	}
+	b := make([]byte, 1+int(length)+4)
+	b[0] = t
+	_, e = io.ReadFull(r, b[1:])
+	if e != nil {
+		return
+	}
+	payload := b[1 : 1+length]
+	sum := binary.BigEndian.Uint32(b[1+length:])
+	if crc32.Update(crc32.Checksum(b[:1], castagnoli), castagnoli, payload) != sum {
+		e = errRecord
+		return
+	}
+	e = s.apply(t, payload)
+	if e != nil {
+		return
+	}
+	n = 1 + uvarintLen(length) + int(length) + 4
+	return
+}
+func uvarintLen(v uint64) int {
+	var b [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(b[:], v)
+}
+func (s *journal) apply(t byte, payload []byte) (e error) {
+	switch t {
+	case recordMetadata:
+		md := &Metadata{}
+		e = md.Unmarshal(payload)
+		if e != nil {
+			return
+		}
+		if s.md == nil {
+			// the first record of a new download
+			s.reset(md)
+		} else {
+			s.md = md
+		}
+	case recordSize:
+		id, n := binary.Varint(payload)
+		if n <= 0 {
+			return errRecord
+		}
+		val, m := binary.Varint(payload[n:])
+		if m <= 0 {
+			return errRecord
+		}
+		s.sizes[id] = utils.Size(val)
+	case recordHash:
+		id, n := binary.Varint(payload)
+		if n <= 0 {
+			return errRecord
+		}
+		s.hashes[id] = append([]byte(nil), payload[n:]...)
+	case recordSplit:
+		var vals [3]int64
+		for i := range vals {
+			v, n := binary.Varint(payload)
+			if n <= 0 {
+				return errRecord
+			}
+			vals[i] = v
+			payload = payload[n:]
+		}
+		s.splits[vals[0]] = &Task{
+			ID:     vals[0],
+			Offset: utils.Size(vals[1]),
+			Num:    utils.Size(vals[2]),
+		}
+	default:
+		return errRecord
+	}
+	return
+}
+
+// append encodes a record to the buffer which is written by write
+func (s *journal) append(t byte, payload []byte) {
+	s.buf = append(s.buf, t)
+	s.buf = appendUvarint(s.buf, uint64(len(payload)))
+	s.buf = append(s.buf, payload...)
+	sum := crc32.Update(crc32.Checksum([]byte{t}, castagnoli), castagnoli, payload)
+	s.buf = append(s.buf, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(s.buf[len(s.buf)-4:], sum)
+	s.records++
+}
+func appendUvarint(b []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+func appendVarint(b []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(b, tmp[:binary.PutVarint(tmp[:], v)]...)
+}
+func (s *journal) appendMetadata() (e error) {
+	val, e := s.md.Marshal()
+	if e != nil {
+		return
+	}
+	s.append(recordMetadata, val)
+	return
+}
+func (s *journal) appendSize(id int64, size utils.Size) {
+	s.append(recordSize, appendVarint(appendVarint(nil, id), int64(size)))
+}
+func (s *journal) appendHash(id int64, hash []byte) {
+	s.append(recordHash, append(appendVarint(nil, id), hash...))
+}
+func (s *journal) appendSplit(t *Task) {
+	s.append(recordSplit, appendVarint(appendVarint(appendVarint(nil, t.ID), int64(t.Offset)), int64(t.Num)))
+}
+
+// write appends the buffered records to the file, the file is synced if sync is true or the last sync is older than journalSyncInterval
+func (s *journal) write(sync bool) (e error) {
+	if len(s.buf) == 0 {
+		return
+	}
+	_, e = s.f.Write(s.buf)
+	s.buf = s.buf[:0]
+	if e != nil {
+		return
+	}
+	s.dirty = true
+	if sync || time.Since(s.synced) >= journalSyncInterval {
+		e = s.sync()
+	}
+	if e == nil && s.records > s.entries()+compactRecords {
+		e = s.compact()
+	}
+	return
+}
+func (s *journal) sync() (e error) {
+	if !s.dirty {
+		return
+	}
+	e = s.f.Sync()
+	if e == nil {
+		s.dirty = false
+		s.synced = time.Now()
+	}
+	return
+}
+
+// compact rewrites the journal with only the current state
+func (s *journal) compact() (e error) {
+	s.buf = s.buf[:0]
+	s.records = 0
+	if s.md != nil {
+		e = s.appendMetadata()
+		if e != nil {
+			return
+		}
+	}
+	for id, size := range s.sizes {
+		s.appendSize(id, size)
+	}
+	for id, hash := range s.hashes {
+		s.appendHash(id, hash)
+	}
+	for _, t := range s.splits {
+		s.appendSplit(t)
+	}
+	temp := s.filename + `.tmp`
+	f, e := os.OpenFile(temp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if e != nil {
+		return
+	}
+	_, e = f.Write(s.buf)
+	s.buf = s.buf[:0]
+	if e == nil {
+		e = f.Sync()
+	}
+	if e == nil {
+		e = os.Rename(temp, s.filename)
+	}
+	if e != nil {
+		f.Close()
+		os.Remove(temp)
+		return
+	}
+	s.f.Close()
+	s.f = f
+	s.dirty = false
+	s.synced = time.Now()
+	return
+}
+func (s *journal) Init(md *Metadata) (e error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.reset(md)
+	return s.compact()
+}
+func (s *journal) SetMetadata(md *Metadata) (e error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.md = md
+	e = s.appendMetadata()
+	if e != nil {
+		return
+	}
+	return s.write(true)
+}
+func (s *journal) Put(batch map[int64]Batch) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.put(batch)
+	for id, v := range batch {
+		s.appendSize(id, utils.Size(v.Val))
+		if v.Hash != nil {
+			s.appendHash(id, v.Hash)
+		}
+	}
+	return s.write(false)
+}
+func (s *journal) Split(tasks ...*Task) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.split(tasks)
+	for _, t := range tasks {
+		s.appendSplit(t)
+	}
+	return s.write(true)
+}
+func (s *journal) Sync() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.sync()
+}
+func (s *journal) Close() (e error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	e = s.sync()
+	if err := s.f.Close(); e == nil {
+		e = err
+	}
+	return
+}
@@ -0,0 +1,113 @@
+package db
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// writeJournal writes the metadata, a split, a finished block and the progress of block 1 in puts records
+func writeJournal(t *testing.T, filename string, puts int) {
+	s, e := openJournal(filename)
+	if e == nil {
+		e = s.Init(&Metadata{Size: 100, Block: 30, ETag: `"v1"`})
+	}
+	if e == nil {
+		e = s.Split(&Task{ID: 2, Offset: 60, Num: 15}, &Task{ID: 4, Offset: 75, Num: 15})
+	}
+	if e == nil {
+		e = s.Put(map[int64]Batch{0: {ID: 0, Val: 30, Hash: []byte{1, 2, 3, 4}}})
+	}
+	for i := 1; e == nil && i <= puts; i++ {
+		e = s.Put(map[int64]Batch{1: {ID: 1, Val: int64(i)}})
+	}
+	if e == nil {
+		e = s.Close()
+	}
+	if e != nil {
+		t.Fatal(e)
+	}
+}
+func TestJournal(t *testing.T) {
+	tests := []struct {
+		name    string
+		puts    int
+		corrupt func(b []byte) []byte
+		// expected size of block 1, 0 if every record is dropped
+		size utils.Size
+	}{
+		{`replay`, 3, nil, 3},
+		{`torn tail`, 3, func(b []byte) []byte { return b[:len(b)-2] }, 2},
+		{`crc mismatch`, 3, func(b []byte) []byte {
+			b[len(b)-1] ^= 0x55
+			return b
+		}, 2},
+		// the replay stops at the corrupted record, the records after it are dropped
+		{`corrupted metadata`, 3, func(b []byte) []byte {
+			b[3] ^= 0x55
+			return b
+		}, 0},
+		{`compact`, compactRecords + 10, nil, compactRecords + 10},
+	}
+	for _, test := range tests {
+		filename := filepath.Join(t.TempDir(), `a.journal`)
+		writeJournal(t, filename, test.puts)
+		b, e := os.ReadFile(filename)
+		if e == nil && test.corrupt != nil {
+			b = test.corrupt(b)
+			e = os.WriteFile(filename, b, 0600)
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		s, e := openJournal(filename)
+		if e != nil {
+			t.Fatal(e)
+		}
+		info, e := os.Stat(filename)
+		if e != nil {
+			t.Fatal(e)
+		} else if test.corrupt != nil && info.Size() >= int64(len(b)) {
+			t.Errorf(`%s: the dropped records are not truncated`, test.name)
+		}
+		// a record appended after the dropped records is replayed
+		e = s.Put(map[int64]Batch{9: {ID: 9, Val: 7}})
+		if e == nil {
+			e = s.Close()
+		}
+		if e == nil {
+			s, e = openJournal(filename)
+		}
+		if e != nil {
+			t.Fatal(e)
+		}
+		md, _ := s.Metadata()
+		size, _ := s.GetSize(1)
+		hash, _ := s.GetHash(0)
+		splits, _ := s.Splits()
+		appended, _ := s.GetSize(9)
+		if size != test.size || appended != 7 {
+			t.Errorf(`%s: expected size %v got %v, appended %v`, test.name, test.size, size, appended)
+		} else if test.size == 0 {
+			if md != nil || hash != nil || len(splits) != 0 {
+				t.Errorf(`%s: records after the corrupted record are replayed`, test.name)
+			}
+		} else if md == nil || md.ETag != `"v1"` || !bytes.Equal(hash, []byte{1, 2, 3, 4}) ||
+			len(splits) != 2 || splits[1].Offset != 75 {
+			t.Errorf(`%s: unexpected state %+v %v %+v`, test.name, md, hash, splits)
+		}
+		if s.records > s.entries()+compactRecords {
+			t.Errorf(`%s: not compacted, %v records of %v entries`, test.name, s.records, s.entries())
+		}
+		s.Close()
+		info, e = os.Stat(filename)
+		if e != nil {
+			t.Fatal(e)
+		} else if info.Size() > 16*1024 {
+			t.Errorf(`%s: journal size %v`, test.name, info.Size())
+		}
+	}
+}
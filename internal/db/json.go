@@ -0,0 +1,207 @@
+package db
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// jsonInterval is the min interval of rewriting the json file by Put
+const jsonInterval = time.Second
+
+// jsonStore writes the whole state to a json file which can be read by humans.
+// The file is replaced by renaming a temp file, the sizes are written at most once every jsonInterval.
+type jsonStore struct {
+	memory
+	filename string
+	last     time.Time
+	dirty    bool
+}
+
+type jsonState struct {
+	Metadata *jsonMetadata `json:"metadata"`
+	Tasks    []jsonTask    `json:"tasks,omitempty"`
+	Splits   []jsonSplit   `json:"splits,omitempty"`
+}
+type jsonMetadata struct {
+	Size     int64  `json:"size"`
+	Block    int64  `json:"block"`
+	Modified string `json:"modified,omitempty"`
+	ETag     string `json:"etag,omitempty"`
+}
+type jsonTask struct {
+	ID   int64 `json:"id"`
+	Size int64 `json:"size"`
+	// hex of the crc32 of the finished block
+	Hash string `json:"hash,omitempty"`
+}
+type jsonSplit struct {
+	ID     int64 `json:"id"`
+	Offset int64 `json:"offset"`
+	Num    int64 `json:"num"`
+}
+
+func openJSON(filename string) (s *jsonStore, e error) {
+	s = &jsonStore{
+		filename: filename,
+	}
+	s.reset(nil)
+	e = s.load()
+	if e != nil {
+		s = nil
+	}
+	return
+}
+
+// readJSON returns the metadata stored in the json file
+func readJSON(filename string) (md *Metadata, e error) {
+	s := &jsonStore{
+		filename: filename,
+	}
+	s.reset(nil)
+	e = s.load()
+	if e != nil {
+		return
+	}
+	md = s.md
+	return
+}
+func (s *jsonStore) load() (e error) {
+	b, e := os.ReadFile(s.filename)
+	if e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	var state jsonState
+	e = json.Unmarshal(b, &state)
+	if e != nil || state.Metadata == nil {
+		return
+	}
+	s.md = &Metadata{
+		Size:     utils.Size(state.Metadata.Size),
+		Block:    utils.Size(state.Metadata.Block),
+		Modified: state.Metadata.Modified,
+		ETag:     state.Metadata.ETag,
+	}
+	for _, t := range state.Tasks {
+		s.sizes[t.ID] = utils.Size(t.Size)
+		if t.Hash != `` {
+			var hash []byte
+			hash, e = hex.DecodeString(t.Hash)
+			if e != nil {
+				return
+			}
+			s.hashes[t.ID] = hash
+		}
+	}
+	for _, t := range state.Splits {
+		s.splits[t.ID] = &Task{
+			ID:     t.ID,
+			Offset: utils.Size(t.Offset),
+			Num:    utils.Size(t.Num),
+		}
+	}
+	return
+}
+
+// save writes the state to a temp file and renames it to the json file
+func (s *jsonStore) save() (e error) {
+	state := jsonState{}
+	if s.md != nil {
+		state.Metadata = &jsonMetadata{
+			Size:     int64(s.md.Size),
+			Block:    int64(s.md.Block),
+			Modified: s.md.Modified,
+			ETag:     s.md.ETag,
+		}
+	}
+	for id, size := range s.sizes {
+		state.Tasks = append(state.Tasks, jsonTask{
+			ID:   id,
+			Size: int64(size),
+			Hash: hex.EncodeToString(s.hashes[id]),
+		})
+	}
+	sort.Slice(state.Tasks, func(i, j int) bool {
+		return state.Tasks[i].ID < state.Tasks[j].ID
+	})
+	for _, t := range s.splits {
+		state.Splits = append(state.Splits, jsonSplit{
+			ID:     t.ID,
+			Offset: int64(t.Offset),
+			Num:    int64(t.Num),
+		})
+	}
+	sort.Slice(state.Splits, func(i, j int) bool {
+		return state.Splits[i].ID < state.Splits[j].ID
+	})
+	b, e := json.MarshalIndent(&state, ``, "\t")
+	if e != nil {
+		return
+	}
+	temp := s.filename + `.tmp`
+	f, e := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if e != nil {
+		return
+	}
+	_, e = f.Write(b)
+	if e == nil {
+		e = f.Sync()
+	}
+	f.Close()
+	if e == nil {
+		e = os.Rename(temp, s.filename)
+	}
+	if e != nil {
+		os.Remove(temp)
+		return
+	}
+	s.last = time.Now()
+	s.dirty = false
+	return
+}
+func (s *jsonStore) Init(md *Metadata) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.reset(md)
+	return s.save()
+}
+func (s *jsonStore) SetMetadata(md *Metadata) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.md = md
+	return s.save()
+}
+func (s *jsonStore) Put(batch map[int64]Batch) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.put(batch)
+	s.dirty = true
+	if time.Since(s.last) < jsonInterval {
+		return nil
+	}
+	return s.save()
+}
+func (s *jsonStore) Split(tasks ...*Task) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.split(tasks)
+	return s.save()
+}
+func (s *jsonStore) Sync() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+func (s *jsonStore) Close() error {
+	return s.Sync()
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"strings"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+type Metadata struct {
+	Size     utils.Size
+	Block    utils.Size
+	Modified string
+	ETag     string
+}
+
+func (m *Metadata) Marshal() ([]byte, error) {
+	var w bytes.Buffer
+	e := gob.NewEncoder(&w).Encode(m)
+	if e != nil {
+		return nil, e
+	}
+	return w.Bytes(), nil
+}
+func (m *Metadata) Unmarshal(b []byte) error {
+	r := bytes.NewReader(b)
+	return gob.NewDecoder(r).Decode(m)
+}
+
+// Diff returns the fields of the stored metadata m not matched with current
+func (m *Metadata) Diff(current *Metadata) (diff []string) {
+	if m.Size != current.Size {
+		diff = append(diff, fmt.Sprintf(`size: %s -> %s`, m.Size, current.Size))
+	}
+	if m.Block != current.Block {
+		diff = append(diff, fmt.Sprintf(`block: %s -> %s`, m.Block, current.Block))
+	}
+	if m.Modified != current.Modified {
+		diff = append(diff, fmt.Sprintf(`modified: %q -> %q`, m.Modified, current.Modified))
+	}
+	// the db of an old version has no ETag
+	if m.ETag != `` && m.ETag != current.ETag {
+		diff = append(diff, fmt.Sprintf(`etag: %q -> %q`, m.ETag, current.ETag))
+	}
+	return
+}
+
+// SameFile returns true if only the block size is changed
+func (m *Metadata) SameFile(current *Metadata) bool {
+	md := *current
+	md.Block = m.Block
+	return len(m.Diff(&md)) == 0
+}
+
+// MismatchError is returned by Load if the downloaded data does not match the current metadata
+type MismatchError struct {
+	Stored  Metadata
+	Current Metadata
+}
+
+func (e *MismatchError) Error() string {
+	return `metadata not matched: ` + strings.Join(e.Stored.Diff(&e.Current), `, `)
+}
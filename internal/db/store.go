@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+const (
+	// StoreBolt stores the state in a bolt db <output>.db
+	StoreBolt = `bolt`
+	// StoreJournal appends the changes of the state to <output>.journal
+	StoreJournal = `journal`
+	// StoreJSON writes the state to <output>.state.json for human inspection
+	StoreJSON = `json`
+	// StoreMemory keeps the state in memory, the download cannot be resumed after exit
+	StoreMemory = `memory`
+)
+
+func CheckStore(store string) error {
+	switch store {
+	case StoreBolt, StoreJournal, StoreJSON, StoreMemory:
+		return nil
+	}
+	return fmt.Errorf(`store only supported bolt journal json or memory, not supported %s`, store)
+}
+
+// Store persists the resume state of a download
+type Store interface {
+	// Metadata returns nil if no metadata is stored
+	Metadata() (*Metadata, error)
+	// Init removes the stored state and stores the metadata of a new download
+	Init(md *Metadata) error
+	// SetMetadata replaces the stored metadata and keeps the state of the tasks
+	SetMetadata(md *Metadata) error
+	GetSize(id int64) (utils.Size, error)
+	GetHash(id int64) ([]byte, error)
+	// Put stores the sizes and the hashes of the batch
+	Put(batch map[int64]Batch) error
+	// Splits returns the tasks changed by splitting
+	Splits() ([]*Task, error)
+	// Split stores the tasks changed by splitting
+	Split(tasks ...*Task) error
+	// Sync writes the state which has not been written
+	Sync() error
+	Close() error
+}
+
+func openStore(store, filename string) (Store, error) {
+	switch store {
+	case StoreBolt:
+		return openBolt(filename)
+	case StoreJournal:
+		return openJournal(filename)
+	case StoreJSON:
+		return openJSON(filename)
+	case StoreMemory:
+		return newMemory(), nil
+	}
+	return nil, CheckStore(store)
+}
+
+// memory keeps the state in memory, it is also the state loaded by journal and json
+type memory struct {
+	m      sync.Mutex
+	md     *Metadata
+	sizes  map[int64]utils.Size
+	hashes map[int64][]byte
+	splits map[int64]*Task
+}
+
+func newMemory() *memory {
+	s := &memory{}
+	s.reset(nil)
+	return s
+}
+func (s *memory) reset(md *Metadata) {
+	s.md = md
+	s.sizes = make(map[int64]utils.Size)
+	s.hashes = make(map[int64][]byte)
+	s.splits = make(map[int64]*Task)
+}
+func (s *memory) put(batch map[int64]Batch) {
+	for id, v := range batch {
+		s.sizes[id] = utils.Size(v.Val)
+		if v.Hash != nil {
+			s.hashes[id] = v.Hash
+		}
+	}
+}
+func (s *memory) split(tasks []*Task) {
+	for _, t := range tasks {
+		s.splits[t.ID] = &Task{
+			ID:     t.ID,
+			Offset: t.Offset,
+			Num:    t.Num,
+		}
+	}
+}
+
+// entries returns the number of the stored values
+func (s *memory) entries() int {
+	return len(s.sizes) + len(s.hashes) + len(s.splits) + 1
+}
+func (s *memory) Metadata() (*Metadata, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.md == nil {
+		return nil, nil
+	}
+	md := *s.md
+	return &md, nil
+}
+func (s *memory) Init(md *Metadata) error {
+	s.m.Lock()
+	s.reset(md)
+	s.m.Unlock()
+	return nil
+}
+func (s *memory) SetMetadata(md *Metadata) error {
+	s.m.Lock()
+	s.md = md
+	s.m.Unlock()
+	return nil
+}
+func (s *memory) GetSize(id int64) (utils.Size, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.sizes[id], nil
+}
+func (s *memory) GetHash(id int64) ([]byte, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.hashes[id], nil
+}
+func (s *memory) Put(batch map[int64]Batch) error {
+	s.m.Lock()
+	s.put(batch)
+	s.m.Unlock()
+	return nil
+}
+func (s *memory) Splits() ([]*Task, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	tasks := make([]*Task, 0, len(s.splits))
+	for _, t := range s.splits {
+		tasks = append(tasks, &Task{
+			ID:     t.ID,
+			Offset: t.Offset,
+			Num:    t.Num,
+		})
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks, nil
+}
+func (s *memory) Split(tasks ...*Task) error {
+	s.m.Lock()
+	s.split(tasks)
+	s.m.Unlock()
+	return nil
+}
+func (s *memory) Sync() error {
+	return nil
+}
+func (s *memory) Close() error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/zuiwuchang/mget/utils"
+)
+
+type Task struct {
+	ID     int64
+	Offset utils.Size
+	// Num is shrunk when the tail of the task is split to another task, read it by Len while the task is downloading
+	Num utils.Size
+
+	m sync.Mutex
+	// bytes reserved by the writer
+	size utils.Size
+}
+
+func (t *Task) Len() utils.Size {
+	t.m.Lock()
+	n := t.Num
+	t.m.Unlock()
+	return n
+}
+
+// Reset sets the bytes already written before the writer starts
+func (t *Task) Reset(size utils.Size) {
+	t.m.Lock()
+	t.size = size
+	t.m.Unlock()
+}
+
+// Reserve returns the bytes the writer is allowed to write of the next n bytes
+func (t *Task) Reserve(n int) int {
+	t.m.Lock()
+	if remain := t.Num - t.size; utils.Size(n) > remain {
+		n = int(remain)
+	}
+	t.size += utils.Size(n)
+	t.m.Unlock()
+	return n
+}
+
+// Remain returns the bytes not reserved by the writer
+func (t *Task) Remain() utils.Size {
+	t.m.Lock()
+	remain := t.Num - t.size
+	t.m.Unlock()
+	return remain
+}
+
+// Split moves the second half of the remaining bytes to a new task if every half is at least min bytes.
+// save is called with the shrunk task and the new task before the task is changed.
+func (t *Task) Split(id int64, min utils.Size, save func(t, split *Task) error) (split *Task, e error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	remain := t.Num - t.size
+	if remain < min*2 {
+		return
+	}
+	at := t.size + remain/2
+	shrunk := &Task{
+		ID:     t.ID,
+		Offset: t.Offset,
+		Num:    at,
+	}
+	split = &Task{
+		ID:     id,
+		Offset: t.Offset + at,
+		Num:    t.Num - at,
+	}
+	e = save(shrunk, split)
+	if e != nil {
+		split = nil
+		return
+	}
+	t.Num = at
+	return
+}
@@ -0,0 +1,184 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval limits how often progress events are written
+const Interval = time.Millisecond * 500
+
+const (
+	TypeStatus     = `status`
+	TypeProgress   = `progress`
+	TypeStepStart  = `step_start`
+	TypeStepFinish = `step_finish`
+	TypeWorker     = `worker`
+	TypeError      = `error`
+)
+
+type Event struct {
+	Type       string    `json:"type"`
+	Time       time.Time `json:"time"`
+	File       string    `json:"file,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Worker     int64     `json:"worker,omitempty"`
+	Workers    int       `json:"workers,omitempty"`
+	Step       int64     `json:"step,omitempty"`
+	Offset     *int64    `json:"offset,omitempty"`
+	Num        int64     `json:"num,omitempty"`
+	Size       int64     `json:"size,omitempty"`
+	Downloaded int64     `json:"downloaded,omitempty"`
+	// bytes per second
+	Speed int64 `json:"speed,omitempty"`
+	// seconds
+	ETA   float64 `json:"eta,omitempty"`
+	Error string  `json:"error,omitempty"`
+}
+
+// Writer writes newline-delimited JSON events, a nil *Writer discards all events
+type Writer struct {
+	*output
+	file     string
+	progress time.Time
+}
+type output struct {
+	wc  io.WriteCloser
+	enc *json.Encoder
+	m   sync.Mutex
+}
+
+// Open opens the event output, name is a file path, - for stdout or fd:N for an inherited file descriptor
+func Open(name string) (w *Writer, e error) {
+	var wc io.WriteCloser
+	if name == `-` {
+		wc = os.Stdout
+	} else if strings.HasPrefix(name, `fd:`) {
+		var fd uint64
+		fd, e = strconv.ParseUint(name[len(`fd:`):], 10, 32)
+		if e != nil {
+			e = fmt.Errorf(`not supported events fd: %s`, name)
+			return
+		}
+		wc = os.NewFile(uintptr(fd), name)
+		if wc == nil {
+			e = fmt.Errorf(`invalid events fd: %s`, name)
+			return
+		}
+	} else {
+		wc, e = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if e != nil {
+			return
+		}
+	}
+	w = &Writer{
+		output: &output{
+			wc:  wc,
+			enc: json.NewEncoder(wc),
+		},
+	}
+	return
+}
+
+// With returns a Writer sharing the same output which marks every event with file
+func (w *Writer) With(file string) *Writer {
+	if w == nil {
+		return nil
+	}
+	return &Writer{
+		output: w.output,
+		file:   file,
+	}
+}
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	if w.wc == os.Stdout {
+		return nil
+	}
+	return w.wc.Close()
+}
+func (w *Writer) Write(evt *Event) {
+	if w == nil {
+		return
+	}
+	w.m.Lock()
+	w.write(evt)
+	w.m.Unlock()
+}
+func (w *Writer) write(evt *Event) {
+	if evt.Time.IsZero() {
+		evt.Time = time.Now()
+	}
+	evt.File = w.file
+	w.enc.Encode(evt)
+}
+func (w *Writer) Status(status string, downloaded, size int64) {
+	w.Write(&Event{
+		Type:       TypeStatus,
+		Status:     status,
+		Downloaded: downloaded,
+		Size:       size,
+	})
+}
+
+// Progress writes a progress event at most once per Interval unless force is true
+func (w *Writer) Progress(downloaded, size, speed int64, eta time.Duration, force bool) {
+	if w == nil {
+		return
+	}
+	w.m.Lock()
+	defer w.m.Unlock()
+	now := time.Now()
+	if !force && now.Sub(w.progress) < Interval {
+		return
+	}
+	w.progress = now
+	w.write(&Event{
+		Type:       TypeProgress,
+		Time:       now,
+		Downloaded: downloaded,
+		Size:       size,
+		Speed:      speed,
+		ETA:        eta.Seconds(),
+	})
+}
+func (w *Writer) StepStart(worker, step, offset, num int64) {
+	w.Write(&Event{
+		Type:   TypeStepStart,
+		Worker: worker,
+		Step:   step,
+		Offset: &offset,
+		Num:    num,
+	})
+}
+func (w *Writer) StepFinish(worker, step, offset, num int64) {
+	w.Write(&Event{
+		Type:   TypeStepFinish,
+		Worker: worker,
+		Step:   step,
+		Offset: &offset,
+		Num:    num,
+	})
+}
+func (w *Writer) Workers(workers int) {
+	w.Write(&Event{
+		Type:    TypeWorker,
+		Workers: workers,
+	})
+}
+func (w *Writer) Error(e error) {
+	w.Write(&Event{
+		Type:  TypeError,
+		Error: e.Error(),
+	})
+}
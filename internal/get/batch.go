@@ -0,0 +1,110 @@
+package get
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/event"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// Batch downloads several files, workers and the rate limit are shared by all files and jobs files are downloaded at the same time
+type Batch struct {
+	managers []*Manager
+	jobs     int
+	budget   Budget
+	limiter  *utils.Limiter
+	events   string
+	done     func(i int, used time.Duration, e error)
+}
+
+// NewBatch creates a batch of managers which have not been served, limitRate is the total rate of all files and 0 is unlimited.
+// If done is not nil it is called with the index of every manager when it stops.
+func NewBatch(managers []*Manager, jobs, workers int, limitRate utils.Size, events string, done func(i int, used time.Duration, e error)) *Batch {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &Batch{
+		managers: managers,
+		jobs:     jobs,
+		budget:   NewBudget(workers),
+		limiter:  utils.NewLimiter(int64(limitRate)),
+		events:   events,
+		done:     done,
+	}
+}
+
+// Serve downloads the files until all are finished or ctx is canceled
+func (b *Batch) Serve(ctx context.Context) (e error) {
+	var events *event.Writer
+	if b.events != `` {
+		events, e = event.Open(b.events)
+		if e != nil {
+			return
+		}
+		defer events.Close()
+	}
+
+	var (
+		ch     = make(chan int)
+		wait   sync.WaitGroup
+		locker sync.Mutex
+		failed int
+	)
+	for i := 0; i < b.jobs; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for i := range ch {
+				if !b.serve(ctx, i, events) {
+					locker.Lock()
+					failed++
+					locker.Unlock()
+				}
+			}
+		}()
+	}
+LOOP:
+	for i := range b.managers {
+		select {
+		case ch <- i:
+		case <-ctx.Done():
+			break LOOP
+		}
+	}
+	close(ch)
+	wait.Wait()
+
+	if e = ctx.Err(); e != nil {
+		return
+	} else if failed != 0 {
+		e = fmt.Errorf(`%v of %v downloads failed`, failed, len(b.managers))
+	}
+	return
+}
+func (b *Batch) serve(ctx context.Context, i int, events *event.Writer) bool {
+	last := time.Now()
+	m := b.managers[i]
+	conf := m.conf
+	m.name = filepath.Base(conf.Output)
+	m.budget = b.budget
+	m.limiter = b.limiter
+	m.events = events.With(conf.Output)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.cancel()
+		case <-done:
+		}
+	}()
+	e := m.Serve()
+	close(done)
+	if b.done != nil {
+		b.done(i, time.Since(last), e)
+	}
+	return e == nil
+}
@@ -0,0 +1,26 @@
+package get
+
+import "context"
+
+// Budget limits how many workers of all managers sharing it download at the same time
+type Budget chan struct{}
+
+func NewBudget(n int) Budget {
+	return make(Budget, n)
+}
+func (b Budget) Acquire(ctx context.Context) bool {
+	if b == nil {
+		return true
+	}
+	select {
+	case b <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+func (b Budget) Release() {
+	if b != nil {
+		<-b
+	}
+}
@@ -0,0 +1,715 @@
+package get
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/event"
+	"github.com/zuiwuchang/mget/internal/get/worker"
+	"github.com/zuiwuchang/mget/internal/headless"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+var errPaused = errors.New(`paused`)
+
+// spaceInterval is the interval of checking the free space while the download is paused because the disk is full
+const spaceInterval = time.Second * 5
+
+type Manager struct {
+	ctx        context.Context
+	cancel     context.CancelFunc
+	finish     chan struct{}
+	conf       *metadata.Configure
+	status     metadata.Status
+	m          sync.Mutex
+	ui         UI
+	events     *event.Writer
+	db         *db.DB
+	name       string
+	budget     Budget
+	block      utils.Size
+	lastID     int64
+	limiter    *utils.Limiter
+	stream     bool
+	sources    []*source
+	workers    int
+	ch         chan *db.Task
+	run        context.Context
+	runCancel  context.CancelFunc
+	running    bool
+	runErr     error
+	throttled  bool
+	noSpace    bool
+	resume     chan struct{}
+	ready      []*Worker
+	workerID   int64
+	wait       sync.WaitGroup
+	waitWorker sync.WaitGroup
+
+	statusSize     utils.Size
+	statusDownload utils.Size
+	statusSteps    int64
+
+	statistics *utils.Statistics
+	rand       *rand.Rand
+
+	progress         func(Stat)
+	progressInterval time.Duration
+}
+
+func NewManager(ctx context.Context, conf *metadata.Configure) *Manager {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Manager{
+		ctx:        ctx,
+		cancel:     cancel,
+		finish:     make(chan struct{}),
+		conf:       conf,
+		ch:         make(chan *db.Task),
+		run:        ctx,
+		resume:     make(chan struct{}, 1),
+		statistics: utils.NewStatistics(time.Second * 5),
+		sources:    newSources(conf),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+		limiter:    utils.NewLimiter(int64(conf.LimitRate)),
+		block:      conf.Block,
+	}
+}
+
+// SetUI replaces the ui selected by the configure, it must be called before Serve
+func (m *Manager) SetUI(ui UI) {
+	m.ui = ui
+}
+
+// SetLimiter shares the total rate limit with other managers, it must be called before Serve
+func (m *Manager) SetLimiter(limiter *utils.Limiter) {
+	m.limiter = limiter
+}
+
+// SetProgress calls f with the progress every interval while serving and once after the download stops, it must be called before Serve
+func (m *Manager) SetProgress(interval time.Duration, f func(Stat)) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	m.progressInterval = interval
+	m.progress = f
+}
+
+type Stat struct {
+	Status   metadata.Status
+	Workers  int
+	Size     utils.Size
+	Download utils.Size
+	Speed    int64
+	ETA      time.Duration
+}
+
+func (m *Manager) Stat() (stat Stat) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	stat.Status = m.status
+	stat.Workers = m.workers
+	stat.Size = m.statusSize
+	stat.Download = m.statusDownload
+	stat.Speed, stat.ETA = m.speed()
+	return
+}
+func (m *Manager) ConfigureView() string {
+	return strings.TrimRight(m.conf.String(), "\n")
+}
+func (m *Manager) Serve() (e error) {
+	ui := m.ui
+	if ui == nil {
+		if m.conf.Headless {
+			ui = headless.New(m.name)
+		} else {
+			ui = newSilent(m.ctx)
+		}
+		m.ui = ui
+	}
+	if m.events == nil && m.conf.Events != `` {
+		m.events, e = event.Open(m.conf.Events)
+		if e != nil {
+			return
+		}
+		defer m.events.Close()
+	}
+
+	e = ui.Init()
+	if e == nil {
+		defer ui.Close()
+		m.m.Lock()
+		e = m.init()
+		if e == nil {
+			m.postStatus(true)
+		}
+		m.m.Unlock()
+		if e == nil {
+			if m.progress != nil {
+				m.wait.Add(1)
+				go func() {
+					defer m.wait.Done()
+					m.reportProgress()
+				}()
+			}
+			e = ui.MainLoop()
+		}
+	}
+	m.cancel()
+	m.wait.Wait()
+	if m.progress != nil {
+		m.progress(m.Stat())
+	}
+	m.m.Lock()
+	status := m.status
+	m.m.Unlock()
+	if status == metadata.StatusSuccess {
+		e = nil
+	} else if m.db != nil {
+		m.db.Close()
+	}
+	return
+}
+func (m *Manager) reportProgress() {
+	ticker := time.NewTicker(m.progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.progress(m.Stat())
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+func (m *Manager) init() (e error) {
+	m.setStatus(metadata.StatusInit)
+	m.workers = m.conf.Worker
+
+	m.wait.Add(1)
+	go func() {
+		defer m.wait.Done()
+		m.serve()
+	}()
+	return
+}
+func (m *Manager) serve() {
+	e := m.prepare()
+	for e == nil {
+		if m.stream {
+			e = m.downloadStream()
+			break
+		}
+		e = m.download()
+		if e == errPaused {
+			e = m.waitResume()
+		} else if errors.Is(e, worker.ErrChanged) {
+			log.Error(e, `, download again from scratch`)
+			e = m.clear()
+			if e == nil {
+				e = m.prepare()
+			}
+		} else {
+			break
+		}
+	}
+	if e != nil {
+		m.ExitWithError(e)
+		return
+	}
+	m.m.Lock()
+	if m.status == metadata.StatusDownload {
+		// the last progress event is always written
+		speed, eta := m.speed()
+		m.events.Progress(int64(m.statusDownload), int64(m.statusSize), speed, eta, true)
+		m.setStatus(metadata.StatusMerge)
+		m.postStatus(true)
+		m.m.Unlock()
+
+		if m.conf.Checksum != nil {
+			m.m.Lock()
+			if m.status != metadata.StatusMerge {
+				m.m.Unlock()
+				return
+			}
+			m.setStatus(metadata.StatusVerify)
+			m.postStatus(true)
+			m.m.Unlock()
+
+			// the temp file is verified before it is moved, a corrupted file never becomes the output
+			e = m.conf.Checksum.Verify(m.files().Temp)
+			if e != nil {
+				if !m.stream {
+					e = fmt.Errorf(`%w, the temp file and the state are kept, run again with --verify to download the blocks changed after they were written`, e)
+				}
+				m.ExitWithError(e)
+				return
+			}
+			log.Info(`checksum matched: `, m.conf.Checksum)
+		}
+		e = m.merge()
+		if e != nil {
+			m.ExitWithError(e)
+			return
+		}
+		m.m.Lock()
+		if m.status == metadata.StatusMerge || m.status == metadata.StatusVerify {
+			m.setStatus(metadata.StatusSuccess)
+			m.postStatus(true)
+		}
+		m.m.Unlock()
+		m.ui.Exit(nil)
+	} else {
+		m.m.Unlock()
+	}
+}
+
+// download runs workers until every task is finished or the run is canceled by pause
+func (m *Manager) download() (e error) {
+	m.m.Lock()
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	m.run, m.runCancel = ctx, cancel
+	m.finish = make(chan struct{})
+	m.clearWorkers()
+	// workers report the size recorded in the db again
+	m.statusDownload = 0
+	m.running = true
+	for i := 0; i < m.workers; i++ {
+		m.createWorker()
+	}
+	m.throttled = false
+	m.postStatus(true)
+	m.m.Unlock()
+	if m.conf.AutoWorker {
+		m.wait.Add(1)
+		go func() {
+			defer m.wait.Done()
+			m.tune(ctx)
+		}()
+	}
+
+	err := m.produce(ctx)
+	if err != nil && ctx.Err() == nil {
+		// stop the workers
+		cancel()
+	} else {
+		err = nil
+	}
+	close(m.finish)
+	m.waitWorker.Wait()
+	m.m.Lock()
+	m.running = false
+	runErr := m.runErr
+	m.runErr = nil
+	m.m.Unlock()
+	if e = m.ctx.Err(); e != nil {
+		return
+	} else if err != nil {
+		e = err
+	} else if runErr != nil {
+		e = runErr
+	} else if ctx.Err() != nil {
+		m.db.Flush()
+		log.Info(`all workers stopped`)
+		e = errPaused
+	}
+	return
+}
+
+// clear removes the downloaded data so the download starts from scratch
+func (m *Manager) clear() error {
+	d := m.db
+	m.db = nil
+	return d.Remove()
+}
+func (m *Manager) waitResume() error {
+	ticker := time.NewTicker(spaceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.resume:
+			m.m.Lock()
+			paused := m.status == metadata.StatusPaused
+			m.m.Unlock()
+			if !paused {
+				return nil
+			}
+		case <-ticker.C:
+			if m.freed() {
+				return nil
+			}
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		}
+	}
+}
+
+// pauseNoSpace pauses the download because the disk is full, it is resumed by the user or when enough space is freed
+func (m *Manager) pauseNoSpace(e error) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.status != metadata.StatusDownload || !m.running {
+		return
+	}
+	log.Error(e, `, pause the download until enough space is freed`)
+	m.events.Error(e)
+	m.noSpace = true
+	m.setStatus(metadata.StatusPaused)
+	m.runCancel()
+	m.postStatus(true)
+}
+
+// freed resumes the download paused by pauseNoSpace if the disk has the space to finish it
+func (m *Manager) freed() bool {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if !m.noSpace || m.status != metadata.StatusPaused {
+		return false
+	}
+	files := m.files()
+	if files.CheckSpace(m.statusSize) != nil {
+		return false
+	}
+	log.Info(`enough space is freed, resume the download`)
+	m.noSpace = false
+	m.setStatus(metadata.StatusDownload)
+	m.postStatus(true)
+	return true
+}
+
+// TogglePause pauses the download or resumes the paused download
+func (m *Manager) TogglePause() {
+	m.m.Lock()
+	defer m.m.Unlock()
+	switch m.status {
+	case metadata.StatusDownload:
+		if m.stream {
+			log.Error(`pause is not supported over a single connection`)
+			return
+		} else if !m.running {
+			return
+		}
+		m.setStatus(metadata.StatusPaused)
+		m.runCancel()
+	case metadata.StatusPaused:
+		m.noSpace = false
+		m.setStatus(metadata.StatusDownload)
+		select {
+		case m.resume <- struct{}{}:
+		default:
+		}
+	default:
+		return
+	}
+	m.postStatus(true)
+}
+func (m *Manager) merge() error {
+	if m.stream {
+		return db.MoveFile(m.files().Temp, m.conf.Output)
+	}
+	return m.db.Finish()
+}
+
+// reserve checks the free space to finish the download and preallocates the temp file if it is configured
+func (m *Manager) reserve() (e error) {
+	files := m.files()
+	e = files.CheckSpace(m.statusSize)
+	if e != nil || !m.conf.Preallocate {
+		return
+	}
+	return m.db.Preallocate(m.statusSize)
+}
+
+// files returns the paths of the temp file and the state
+func (m *Manager) files() db.Files {
+	return db.NewFiles(m.conf.Output, m.conf.Store, m.conf.TempDir, m.conf.StateDir)
+}
+
+func (m *Manager) setStatus(status metadata.Status) {
+	m.status = status
+	log.Info(`Status: `, status)
+	m.events.Status(status.String(), int64(m.statusDownload), int64(m.statusSize))
+}
+func (m *Manager) postStatus(safe bool) {
+	if m.ui == nil {
+		return
+	}
+	if !safe {
+		m.m.Lock()
+		defer m.m.Unlock()
+	}
+
+	md := ``
+	if m.statusSteps != 0 {
+		md += fmt.Sprintf(` steps: %v`, m.statusSteps)
+	}
+	if m.statusSize != 0 || m.statusDownload != 0 {
+		if m.statusSize == 0 {
+			md += fmt.Sprintf(` download: %s`, m.statusDownload)
+		} else {
+			md += fmt.Sprintf(` download: %s/%s`, m.statusDownload, m.statusSize)
+		}
+		speed, eta := m.speed()
+		if speed != 0 {
+			md += fmt.Sprintf(` [%s/s]`, utils.Size(speed))
+			if eta != 0 {
+				md += fmt.Sprintf(` %s ETA`, eta)
+			}
+		}
+	}
+
+	if len(m.sources) > 1 {
+		md += fmt.Sprintf(` mirror: %v/%v`, m.aliveSources(), len(m.sources))
+	}
+	if rate := m.limiter.Rate(); rate != 0 {
+		md += fmt.Sprintf(` limit: %s/s`, utils.Size(rate))
+	}
+
+	auto := ``
+	if m.conf.AutoWorker {
+		auto = `auto `
+	}
+	status := m.status.String()
+	if m.noSpace && m.status == metadata.StatusPaused {
+		status += ` (disk full)`
+	}
+	body := fmt.Sprintf(`status: %s worker: %s%v/%v%s`, status, auto, m.workers, len(m.ready), md)
+	m.ui.SetStatus(body)
+}
+func (m *Manager) speed() (speed int64, eta time.Duration) {
+	if m.statusDownload == 0 {
+		return
+	}
+	speed = m.statistics.Speed()
+	if speed != 0 && m.statusDownload < m.statusSize {
+		eta = time.Second * time.Duration(m.statusSize-m.statusDownload) / time.Duration(speed)
+	}
+	return
+}
+
+// clearWorkers removes the workers left by the last run
+func (m *Manager) clearWorkers() {
+	for _, w := range m.ready {
+		if w.source != nil {
+			w.source.workers--
+		}
+	}
+	m.ready = nil
+	m.updateWorkerStatus()
+}
+func (m *Manager) createWorker() {
+	m.workerID++
+	w := NewWorker(m.workerID, m)
+	m.waitWorker.Add(1)
+	m.wait.Add(1)
+	m.ready = append(m.ready, w)
+	go func() {
+		defer func() {
+			m.waitWorker.Done()
+			m.wait.Done()
+		}()
+		w.Serve()
+	}()
+}
+func (m *Manager) Context() context.Context {
+	return m.run
+}
+func (m *Manager) GetChannel() <-chan *db.Task {
+	return m.ch
+}
+
+func (m *Manager) Increase() {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.status > metadata.StatusError || m.stream {
+		return
+	} else if m.workers == metadata.MaxWorkers {
+		return
+	}
+
+	m.workers++
+	if m.running {
+		m.createWorker()
+	}
+	m.events.Workers(m.workers)
+	m.postStatus(true)
+	m.updateWorkerStatus()
+}
+func (m *Manager) Reduce() {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.status > metadata.StatusError || m.stream {
+		return
+	} else if m.workers == 1 {
+		return
+	}
+
+	m.workers--
+	if m.running {
+		run, finish := m.run, m.finish
+		go func() {
+			select {
+			case m.ch <- nil:
+			case <-run.Done():
+			case <-finish:
+			}
+		}()
+	}
+	m.events.Workers(m.workers)
+	m.postStatus(true)
+	m.updateWorkerStatus()
+}
+func (m *Manager) prepare() (e error) {
+	remote, e := m.conf.GetMetadata(m.ctx, m.conf.URL)
+	if e != nil {
+		return
+	}
+	e = m.conf.GetChecksum(m.ctx)
+	if e != nil {
+		return
+	}
+	if !remote.Range {
+		size := `unknown`
+		if remote.Size >= 0 {
+			size = utils.Size(remote.Size).String()
+		}
+		log.Infof(`Metadata: size=%s modified=%s, range requests not supported, download over a single connection`,
+			size, remote.Modified,
+		)
+		m.m.Lock()
+		m.stream = true
+		if remote.Size > 0 {
+			m.statusSize = utils.Size(remote.Size)
+		}
+		m.setStatus(metadata.StatusDownload)
+		m.postStatus(true)
+		m.m.Unlock()
+		return
+	}
+	m.m.Lock()
+	m.sources[0].ifRange = remote.IfRange()
+	m.m.Unlock()
+	m.checkMirrors(remote)
+	size := utils.Size(remote.Size)
+	modified := remote.Modified
+	m.m.Lock()
+	m.statusSize = size
+	m.setSteps()
+	log.Infof(`Metadata: size=%s steps=%v modified=%s`, size, m.statusSteps, modified)
+	m.postStatus(true)
+	m.m.Unlock()
+
+	d, e := db.OpenDB(m.files())
+	if e != nil {
+		return
+	}
+	m.db = d
+	log.Info(`open db: `, m.conf.Store, ` `, d.Filename)
+	e = d.Load(size, m.block, modified, remote.ETag)
+	if mismatch, ok := e.(*db.MismatchError); ok {
+		e = m.mismatch(mismatch)
+	}
+	if e != nil {
+		return
+	}
+	e = m.reserve()
+	if e != nil {
+		return
+	}
+	m.m.Lock()
+	m.setStatus(metadata.StatusDownload)
+	m.postStatus(true)
+	m.m.Unlock()
+	return
+}
+
+// setSteps must be called with m.m locked
+func (m *Manager) setSteps() {
+	size, block := int64(m.statusSize), int64(m.block)
+	m.statusSteps = (size + block - 1) / block
+}
+
+// mismatch handles the downloaded data not matched with the metadata by the configured policy
+func (m *Manager) mismatch(mismatch *db.MismatchError) (e error) {
+	log.Error(mismatch)
+	policy := m.conf.Mismatch
+	sameFile := mismatch.Stored.SameFile(&mismatch.Current)
+	if !sameFile && m.conf.RestartChanged {
+		policy = metadata.MismatchRestart
+	}
+	switch policy {
+	case metadata.MismatchRestart:
+		log.Info(`download again from scratch`)
+		e = m.clear()
+		if e != nil {
+			return
+		}
+		var d *db.DB
+		d, e = db.OpenDB(m.files())
+		if e != nil {
+			return
+		}
+		m.db = d
+		c := &mismatch.Current
+		e = d.Load(c.Size, c.Block, c.Modified, c.ETag)
+	case metadata.MismatchKeepBlock:
+		if !sameFile {
+			e = fmt.Errorf(`the old block size cannot be kept, %w`, mismatch)
+			return
+		}
+		log.Info(`keep the old block size: `, mismatch.Stored.Block)
+		m.m.Lock()
+		m.block = mismatch.Stored.Block
+		m.setSteps()
+		m.postStatus(true)
+		m.m.Unlock()
+		c := &mismatch.Current
+		e = m.db.Load(c.Size, m.block, c.Modified, c.ETag)
+	default:
+		e = mismatch
+	}
+	return
+}
+func (m *Manager) produce(ctx context.Context) (e error) {
+	tasks, e := m.db.Tasks(m.statusSize, m.block)
+	if e != nil {
+		return
+	}
+	m.m.Lock()
+	m.statusSteps = int64(len(tasks))
+	for _, t := range tasks {
+		if t.ID > m.lastID {
+			m.lastID = t.ID
+		}
+	}
+	m.m.Unlock()
+	for _, t := range tasks {
+		select {
+		case m.ch <- t:
+		case <-ctx.Done():
+			e = ctx.Err()
+			return
+		}
+	}
+	return
+}
+func (m *Manager) ExitWithError(e error) {
+	m.m.Lock()
+	if m.status < metadata.StatusError ||
+		m.status == metadata.StatusMerge ||
+		m.status == metadata.StatusVerify {
+		m.status = metadata.StatusError
+		m.events.Error(e)
+		m.events.Status(m.status.String(), int64(m.statusDownload), int64(m.statusSize))
+		m.ui.Exit(e)
+	}
+	m.m.Unlock()
+}
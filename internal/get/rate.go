@@ -0,0 +1,46 @@
+package get
+
+import (
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// MinRate is the lowest rate limit set from the ui
+const MinRate = utils.K
+
+func (m *Manager) IncreaseRate() {
+	rate := m.limiter.Rate()
+	if rate == 0 {
+		return
+	}
+	m.setRate(rate * 2)
+}
+func (m *Manager) ReduceRate() {
+	rate := m.limiter.Rate()
+	if rate == 0 {
+		// start limiting from the current speed
+		m.m.Lock()
+		rate = m.statistics.Speed()
+		m.m.Unlock()
+		if rate == 0 {
+			rate = utils.M
+		}
+	}
+	rate /= 2
+	if rate < MinRate {
+		rate = MinRate
+	}
+	m.setRate(rate)
+}
+func (m *Manager) UnlimitRate() {
+	m.setRate(0)
+}
+func (m *Manager) setRate(rate int64) {
+	m.limiter.SetRate(rate)
+	if rate == 0 {
+		log.Info(`limit rate: unlimited`)
+	} else {
+		log.Infof(`limit rate: %s/s`, utils.Size(rate))
+	}
+	m.postStatus(false)
+}
@@ -0,0 +1,210 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/get/worker"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/internal/metadata"
+)
+
+// source is a mirror serving the file, every worker is bound to a source and fetches blocks only from it,
+// so a slow source gets fewer blocks
+type source struct {
+	URL string
+	// validator sent in If-Range
+	ifRange string
+	dropped bool
+	workers int
+}
+
+func newSources(conf *metadata.Configure) []*source {
+	sources := make([]*source, 0, 1+len(conf.Mirrors))
+	sources = append(sources, &source{
+		URL: conf.URL,
+	})
+	for _, url := range conf.Mirrors {
+		sources = append(sources, &source{
+			URL: url,
+		})
+	}
+	return sources
+}
+
+// checkMirrors drops the mirrors which do not serve the same file as the primary url
+func (m *Manager) checkMirrors(remote *metadata.Remote) {
+	if len(m.sources) < 2 {
+		return
+	}
+	var wait sync.WaitGroup
+	for _, src := range m.sources[1:] {
+		wait.Add(1)
+		go func(src *source) {
+			defer wait.Done()
+			mirror, e := m.conf.GetMetadata(m.ctx, src.URL)
+			if e == nil {
+				e = remote.Match(mirror)
+			}
+			if e == nil {
+				m.m.Lock()
+				src.ifRange = mirror.IfRange()
+				m.m.Unlock()
+			} else {
+				m.m.Lock()
+				src.dropped = true
+				m.m.Unlock()
+				log.Errorf(`drop mirror %s: %v`, src.URL, e)
+			}
+		}(src)
+	}
+	wait.Wait()
+}
+func (m *Manager) aliveSources() (count int) {
+	for _, src := range m.sources {
+		if !src.dropped {
+			count++
+		}
+	}
+	return
+}
+func (m *Manager) bindSource(worker *worker.Worker) (src *source) {
+	w := m.getWorker(worker)
+	if w != nil && w.source != nil && !w.source.dropped {
+		src = w.source
+		return
+	}
+	for _, node := range m.sources {
+		if node.dropped {
+			continue
+		} else if src == nil || node.workers < src.workers {
+			src = node
+		}
+	}
+	if w != nil && src != nil {
+		if w.source != nil {
+			w.source.workers--
+		}
+		w.source = src
+		src.workers++
+	}
+	return
+}
+func (m *Manager) GetRequest(worker *worker.Worker) (req *http.Request, e error) {
+	m.m.Lock()
+	src := m.bindSource(worker)
+	m.m.Unlock()
+	if src == nil {
+		e = errors.New(`no mirror available`)
+		return
+	}
+	req, e = m.conf.NewRequestWithContext(m.run, http.MethodGet, src.URL, nil)
+	if e == nil && src.ifRange != `` {
+		req.Header.Set(`If-Range`, src.ifRange)
+	}
+	return
+}
+
+// Fail retries the failed request with backoff, after the retries are exhausted it drops the mirror if another mirror is available.
+// It returns false if the download should stop.
+func (m *Manager) Fail(worker *worker.Worker, e error) bool {
+	if m.ctx.Err() == nil && m.run.Err() != nil {
+		// paused
+		return false
+	}
+	if m.ctx.Err() == nil && db.IsNoSpace(e) {
+		m.pauseNoSpace(e)
+		return false
+	}
+	se := asSourceError(e)
+	if m.ctx.Err() != nil || se == nil {
+		m.ExitWithError(e)
+		return false
+	}
+	m.m.Lock()
+	if m.conf.RestartChanged && isChanged(se) && m.aliveSources() < 2 {
+		if m.runErr == nil {
+			m.runErr = e
+			m.runCancel()
+		}
+		m.m.Unlock()
+		return false
+	}
+	if se.StatusCode == http.StatusTooManyRequests || se.StatusCode == http.StatusServiceUnavailable {
+		m.throttled = true
+	}
+	w := m.getWorker(worker)
+	if w == nil {
+		m.m.Unlock()
+		m.ExitWithError(e)
+		return false
+	}
+	var wait time.Duration
+	if se.Temporary() && w.attempts < m.conf.Retry {
+		w.attempts++
+		wait = m.backoff(w.attempts)
+		w.Status = fmt.Sprintf(`worker-%v: Retry %v/%v after %v: %v`, worker.ID, w.attempts, m.conf.Retry, wait, se.Err)
+		m.updateWorkerStatus()
+		log.Errorf(`worker-%v retry %v/%v after %v: %v`, worker.ID, w.attempts, m.conf.Retry, wait, e)
+	} else if m.dropSource(se.URL, se.Err) {
+		w.attempts = 0
+	} else {
+		m.m.Unlock()
+		m.ExitWithError(e)
+		return false
+	}
+	m.m.Unlock()
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-m.run.Done():
+			timer.Stop()
+			return false
+		}
+	}
+	return true
+}
+
+func asSourceError(e error) (se *worker.SourceError) {
+	errors.As(e, &se)
+	return
+}
+func isChanged(se *worker.SourceError) bool {
+	return se.Err == worker.ErrChanged
+}
+
+// backoff returns the exponential backoff with jitter of the attempt
+func (m *Manager) backoff(attempt int) time.Duration {
+	wait := m.conf.RetryWait
+	for i := 1; i < attempt && wait < m.conf.RetryMaxWait; i++ {
+		wait *= 2
+	}
+	if wait > m.conf.RetryMaxWait {
+		wait = m.conf.RetryMaxWait
+	}
+	if wait > 1 {
+		wait = wait/2 + time.Duration(m.rand.Int63n(int64(wait/2)+1))
+	}
+	return wait
+}
+func (m *Manager) dropSource(url string, e error) bool {
+	if m.aliveSources() < 2 {
+		return false
+	}
+	for _, src := range m.sources {
+		if src.URL == url {
+			if !src.dropped {
+				src.dropped = true
+				log.Errorf(`drop mirror %s: %v`, url, e)
+				m.postStatus(true)
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package get
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/metadata"
+)
+
+func TestBackoff(t *testing.T) {
+	m := &Manager{
+		conf: &metadata.Configure{
+			RetryWait:    time.Second,
+			RetryMaxWait: time.Second * 10,
+		},
+		rand: rand.New(rand.NewSource(1)),
+	}
+	tests := []struct {
+		attempt int
+		// the wait is jittered in [max/2, max]
+		max time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second * 2},
+		{3, time.Second * 4},
+		{4, time.Second * 8},
+		{5, time.Second * 10},
+		{100, time.Second * 10},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			if wait := m.backoff(test.attempt); wait < test.max/2 || wait > test.max {
+				t.Fatalf(`attempt %v: expected [%v, %v] got %v`, test.attempt, test.max/2, test.max, wait)
+			}
+		}
+	}
+}
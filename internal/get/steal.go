@@ -0,0 +1,62 @@
+package get
+
+import (
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/get/worker"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// MinSplit is the min size of a task split from another task
+const MinSplit = 256 * utils.K
+
+// Steal splits the tail of the task which needs the most time to finish
+func (m *Manager) Steal(thief *worker.Worker) (t *db.Task) {
+	m.m.Lock()
+	defer m.m.Unlock()
+	if m.status != metadata.StatusDownload || m.run.Err() != nil {
+		return
+	}
+	var (
+		victim *Worker
+		eta    time.Duration
+	)
+	for _, w := range m.ready {
+		if w.task == nil || w.Worker == thief {
+			continue
+		}
+		remain := w.task.Remain()
+		if remain < MinSplit*2 {
+			continue
+		}
+		// a stalled worker needs the most time
+		current := time.Duration(1<<63 - 1)
+		if speed := w.Speed(); speed > 0 {
+			current = time.Second * time.Duration(remain) / time.Duration(speed)
+		}
+		if victim == nil || current > eta {
+			victim = w
+			eta = current
+		}
+	}
+	if victim == nil {
+		return
+	}
+	t, e := victim.task.Split(m.lastID+1, MinSplit, m.db.Split)
+	if e != nil {
+		log.Error(`split step: `, e)
+		return
+	} else if t == nil {
+		return
+	}
+	m.lastID = t.ID
+	m.statusSteps++
+	log.Infof(`worker-%v steal step %v offset: %s size: %s from worker-%v step %v`,
+		thief.ID, t.ID, t.Offset, t.Num, victim.ID, victim.task.ID,
+	)
+	m.postStatus(true)
+	return
+}
@@ -0,0 +1,92 @@
+package get
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+func TestSteal(t *testing.T) {
+	output := filepath.Join(t.TempDir(), `a.bin`)
+	d, e := db.OpenDB(db.NewFiles(output, db.StoreMemory, ``, ``))
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer d.Close()
+	m := NewManager(context.Background(), &metadata.Configure{URL: `http://127.0.0.1/a.bin`})
+	m.db = d
+	m.status = metadata.StatusDownload
+	m.lastID = 3
+
+	thief := NewWorker(1, m)
+	tests := []struct {
+		name string
+		// the tasks are downloaded by the thief
+		own   bool
+		tasks []*db.Task
+		// written bytes of the tasks
+		written []utils.Size
+		// index of the victim, -1 if nothing is split
+		victim int
+	}{
+		{`idle`, false, nil, nil, -1},
+		{`small`, false, []*db.Task{{ID: 0, Num: MinSplit*2 + 1}}, []utils.Size{2}, -1},
+		{`own task`, true, []*db.Task{{ID: 0, Num: MinSplit * 4}}, []utils.Size{0}, -1},
+		{`split`, false, []*db.Task{
+			{ID: 0, Num: MinSplit * 3},
+			{ID: 1, Offset: MinSplit * 3, Num: MinSplit * 8},
+			{ID: 2, Offset: MinSplit * 11, Num: MinSplit},
+		}, []utils.Size{MinSplit * 2, MinSplit * 2, 0}, 1},
+	}
+	for _, test := range tests {
+		m.ready = nil
+		for i, task := range test.tasks {
+			task.Reset(test.written[i])
+			w := thief
+			if !test.own {
+				w = NewWorker(int64(10+i), m)
+			}
+			w.task = task
+			m.ready = append(m.ready, w)
+		}
+		var nums []utils.Size
+		for _, task := range test.tasks {
+			nums = append(nums, task.Len())
+		}
+		lastID := m.lastID
+
+		split := m.Steal(thief.Worker)
+		if test.victim < 0 {
+			if split != nil {
+				t.Errorf(`%s: unexpected split %+v`, test.name, split)
+			}
+			continue
+		}
+		victim := test.tasks[test.victim]
+		// the second half of the remaining bytes is split
+		at := test.written[test.victim] + (nums[test.victim]-test.written[test.victim])/2
+		if split == nil {
+			t.Fatalf(`%s: not split`, test.name)
+		} else if split.ID != lastID+1 || m.lastID != split.ID ||
+			split.Offset != victim.Offset+at || split.Num != nums[test.victim]-at ||
+			victim.Len() != at {
+			t.Errorf(`%s: unexpected split %+v of %+v`, test.name, split, victim)
+		}
+		for i, task := range test.tasks {
+			if i != test.victim && task.Len() != nums[i] {
+				t.Errorf(`%s: task %v changed`, test.name, task.ID)
+			}
+		}
+	}
+
+	// nothing is split after the download is finished
+	m.status = metadata.StatusMerge
+	m.ready = []*Worker{{task: &db.Task{ID: 0, Num: MinSplit * 4}}}
+	if split := m.Steal(thief.Worker); split != nil {
+		t.Errorf(`split after the download: %+v`, split)
+	}
+}
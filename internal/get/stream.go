@@ -0,0 +1,159 @@
+package get
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/get/worker"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+// downloadStream downloads the whole file over a single connection, it cannot be resumed so a retry downloads again from scratch
+func (m *Manager) downloadStream() (e error) {
+	m.ui.SetWorker(`stream: the server does not support range requests, download over a single connection without resume`)
+	files := m.files()
+	e = files.Mkdir()
+	if e != nil {
+		return
+	}
+	for attempt := 1; ; attempt++ {
+		e = m.getStream(files)
+		if e == errPaused {
+			// the disk is full, download again from scratch after the space is freed
+			e = m.waitResume()
+			if e != nil {
+				return
+			}
+			attempt = 0
+			continue
+		}
+		se := asSourceError(e)
+		if e == nil || se == nil || !se.Temporary() ||
+			attempt > m.conf.Retry || m.ctx.Err() != nil {
+			return
+		}
+		m.m.Lock()
+		wait := m.backoff(attempt)
+		m.m.Unlock()
+		log.Errorf(`stream retry %v/%v after %v: %v`, attempt, m.conf.Retry, wait, e)
+		m.ui.SetWorker(fmt.Sprintf(`stream: Retry %v/%v after %v: %v`, attempt, m.conf.Retry, wait, se.Err))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-m.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+func (m *Manager) getStream(files db.Files) (e error) {
+	m.m.Lock()
+	ctx, cancel := context.WithCancel(m.ctx)
+	defer cancel()
+	m.run, m.runCancel = ctx, cancel
+	m.running = true
+	m.m.Unlock()
+	defer func() {
+		m.m.Lock()
+		m.running = false
+		m.m.Unlock()
+	}()
+	// the connection takes a worker shared by the batch
+	if !m.budget.Acquire(ctx) {
+		e = ctx.Err()
+		return
+	}
+	defer m.budget.Release()
+	req, e := m.conf.NewRequestWithContext(ctx, http.MethodGet, m.conf.URL, nil)
+	if e != nil {
+		return
+	}
+	log.Info(req.Method, ` `, req.URL)
+	resp, e := m.Do(req)
+	if e != nil {
+		e = &worker.SourceError{URL: m.conf.URL, Err: e}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e = &worker.SourceError{
+			URL:        m.conf.URL,
+			Err:        fmt.Errorf(`not StatusOK: %v %v`, resp.StatusCode, resp.Status),
+			StatusCode: resp.StatusCode,
+		}
+		return
+	}
+	if resp.ContentLength > 0 {
+		e = files.CheckSpace(utils.Size(resp.ContentLength))
+		if e != nil {
+			return
+		}
+	}
+	f, e := os.Create(files.Temp)
+	if e != nil {
+		return
+	}
+	writer := &streamWriter{
+		m:       m,
+		f:       f,
+		limiter: utils.NewLimiter(int64(m.conf.LimitRateWorker)),
+	}
+	body := worker.NewStallReader(resp.Body, m.conf.StallTimeout, cancel)
+	n, e := io.Copy(writer, body)
+	body.Stop()
+	f.Close()
+	if e == nil && resp.ContentLength >= 0 && n != resp.ContentLength {
+		e = io.ErrUnexpectedEOF
+	}
+	if e != nil {
+		if body.Stalled() {
+			e = &worker.SourceError{URL: m.conf.URL, Err: worker.ErrStalled}
+		} else if ctx.Err() != nil && m.ctx.Err() == nil {
+			// paused by pauseNoSpace
+			e = errPaused
+		} else if writer.err == nil && m.ctx.Err() == nil {
+			e = &worker.SourceError{URL: m.conf.URL, Err: e}
+		}
+		// the temp file is written again from scratch
+		m.WriteStatus(-writer.size, false)
+	}
+	return
+}
+
+type streamWriter struct {
+	m *Manager
+	f *os.File
+	// rate limit of the connection, the same as the limit of a worker
+	limiter *utils.Limiter
+	size    int64
+	err     error
+}
+
+func (w *streamWriter) Write(p []byte) (n int, e error) {
+	e = w.limiter.Wait(w.m.ctx, len(p))
+	if e == nil {
+		e = w.m.Limit(len(p))
+	}
+	if e != nil {
+		w.err = e
+		return
+	}
+	n, e = w.f.Write(p)
+	if n != 0 {
+		w.size += int64(n)
+		w.m.WriteStatus(int64(n), true)
+	}
+	if e != nil {
+		w.err = e
+		if w.m.ctx.Err() == nil && db.IsNoSpace(e) {
+			w.m.pauseNoSpace(e)
+		}
+	}
+	return
+}
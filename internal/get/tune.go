@@ -0,0 +1,92 @@
+package get
+
+import (
+	"context"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/internal/metadata"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+const (
+	// interval between two measurements, it is the window of the speed statistics
+	tuneInterval = time.Second * 5
+	// intervals to keep the number of workers after it stopped helping or the server throttled
+	tuneHold = 6
+)
+
+// tuner adds a worker while the throughput keeps rising and removes workers when they stop helping
+type tuner struct {
+	// throughput measured before the last worker was added
+	speed     int64
+	increased bool
+	hold      int
+}
+
+// tune changes the number of workers by the measured throughput until the run is finished or canceled
+func (m *Manager) tune(ctx context.Context) {
+	var t tuner
+	ticker := time.NewTicker(tuneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		m.m.Lock()
+		if m.status != metadata.StatusDownload {
+			m.m.Unlock()
+			continue
+		}
+		throttled := m.throttled
+		m.throttled = false
+		speed := m.statistics.Speed()
+		workers := m.workers
+		m.m.Unlock()
+
+		n := t.next(speed, workers, throttled)
+		if n < workers {
+			if throttled {
+				log.Infof(`auto worker: the server is throttling, reduce workers %v -> %v`, workers, n)
+			} else {
+				log.Infof(`auto worker: %s/s -> %s/s, reduce workers %v -> %v`,
+					utils.Size(t.speed), utils.Size(speed), workers, n,
+				)
+			}
+			for i := n; i < workers; i++ {
+				m.Reduce()
+			}
+		} else if n > workers {
+			log.Infof(`auto worker: %s/s, increase workers %v -> %v`, utils.Size(speed), workers, n)
+			m.Increase()
+		}
+	}
+}
+
+// next returns the number of workers after the throughput is measured
+func (t *tuner) next(speed int64, workers int, throttled bool) int {
+	if throttled {
+		t.increased = false
+		t.hold = tuneHold
+		if workers/2 < 1 {
+			return 1
+		}
+		return workers / 2
+	} else if t.increased {
+		t.increased = false
+		// less than 5% faster
+		if speed*100 < t.speed*105 {
+			t.hold = tuneHold
+			return workers - 1
+		}
+	} else if t.hold > 0 {
+		t.hold--
+	} else if speed > 0 && workers < metadata.MaxWorkers {
+		t.speed = speed
+		t.increased = true
+		return workers + 1
+	}
+	return workers
+}
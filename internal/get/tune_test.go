@@ -0,0 +1,45 @@
+package get
+
+import (
+	"testing"
+)
+
+func TestTuner(t *testing.T) {
+	type step struct {
+		speed     int64
+		throttled bool
+		workers   int
+	}
+	steps := []step{
+		// nothing is downloaded
+		{0, false, 4},
+		{100, false, 5},
+		// more than 5% faster, the worker is kept and another worker is added by the next measurement
+		{110, false, 5},
+		{110, false, 6},
+		// the last worker stopped helping
+		{112, false, 5},
+	}
+	for i := 0; i < tuneHold; i++ {
+		steps = append(steps, step{200, false, 5})
+	}
+	steps = append(steps,
+		step{200, false, 6},
+		step{300, true, 3},
+		// the workers are kept after the server throttled
+		step{600, false, 3},
+	)
+
+	var tun tuner
+	workers := 4
+	for i, step := range steps {
+		workers = tun.next(step.speed, workers, step.throttled)
+		if workers != step.workers {
+			t.Fatalf(`step %v: expected %v workers got %v`, i, step.workers, workers)
+		}
+	}
+	tun = tuner{}
+	if workers = tun.next(0, 1, true); workers != 1 {
+		t.Errorf(`throttled: expected 1 worker got %v`, workers)
+	}
+}
@@ -0,0 +1,52 @@
+package get
+
+import (
+	"context"
+	"sync"
+)
+
+type UI interface {
+	Init() error
+	Close()
+	MainLoop() error
+	SetStatus(body string)
+	SetWorker(body string)
+	// Exit makes MainLoop return, e == nil means the download is finished
+	Exit(e error)
+}
+
+// silent keeps the manager running without drawing anything, the progress is read by Manager.Stat
+type silent struct {
+	ctx  context.Context
+	exit chan error
+	once sync.Once
+}
+
+func newSilent(ctx context.Context) *silent {
+	return &silent{
+		ctx:  ctx,
+		exit: make(chan error, 1),
+	}
+}
+func (u *silent) Init() error {
+	return nil
+}
+func (u *silent) Close() {
+}
+func (u *silent) MainLoop() error {
+	select {
+	case e := <-u.exit:
+		return e
+	case <-u.ctx.Done():
+		return u.ctx.Err()
+	}
+}
+func (u *silent) SetStatus(body string) {
+}
+func (u *silent) SetWorker(body string) {
+}
+func (u *silent) Exit(e error) {
+	u.once.Do(func() {
+		u.exit <- e
+	})
+}
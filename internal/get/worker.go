@@ -0,0 +1,127 @@
+package get
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/get/worker"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+type Worker struct {
+	*worker.Worker
+	Status   string
+	source   *source
+	attempts int
+	// task being downloaded
+	task *db.Task
+}
+
+func NewWorker(id int64, rely worker.Rely) *Worker {
+	return &Worker{
+		Worker: worker.New(id, rely),
+	}
+}
+func (m *Manager) getWorker(worker *worker.Worker) *Worker {
+	for _, w := range m.ready {
+		if w.Worker == worker {
+			return w
+		}
+	}
+	return nil
+}
+func (m *Manager) DeleteWorker(worker *worker.Worker) {
+	m.m.Lock()
+	for i, w := range m.ready {
+		if w.Worker == worker {
+			if w.source != nil {
+				w.source.workers--
+			}
+			m.ready = append(m.ready[:i], m.ready[i+1:]...)
+			break
+		}
+	}
+	m.postStatus(true)
+	m.updateWorkerStatus()
+	m.m.Unlock()
+}
+func (m *Manager) WorkerStatus(worker *worker.Worker, status string) {
+	m.m.Lock()
+	for _, w := range m.ready {
+		if w.Worker == worker {
+			w.Status = status
+			m.updateWorkerStatus()
+			break
+		}
+	}
+	m.m.Unlock()
+}
+func (m *Manager) updateWorkerStatus() {
+	strs := make([]string, len(m.ready))
+	for i, w := range m.ready {
+		strs[i] = w.Status
+	}
+	m.ui.SetWorker(strings.Join(strs, "\n"))
+}
+func (m *Manager) DB() *db.DB {
+	return m.db
+}
+func (m *Manager) Block() utils.Size {
+	return m.block
+}
+func (m *Manager) Limit(n int) error {
+	return m.limiter.Wait(m.run, n)
+}
+func (m *Manager) WorkerRate() utils.Size {
+	return m.conf.LimitRateWorker
+}
+func (m *Manager) StallTimeout() time.Duration {
+	return m.conf.StallTimeout
+}
+func (m *Manager) Verify() bool {
+	return m.conf.Verify
+}
+func (m *Manager) WriteStatus(n int64, net bool) {
+	m.m.Lock()
+	m.statusDownload += utils.Size(n)
+	if net {
+		m.statistics.Push(n)
+	}
+	m.postStatus(true)
+	if m.events != nil {
+		speed, eta := m.speed()
+		m.events.Progress(int64(m.statusDownload), int64(m.statusSize), speed, eta, false)
+	}
+	m.m.Unlock()
+}
+func (m *Manager) StartStep(worker *worker.Worker, t *db.Task) {
+	m.m.Lock()
+	if w := m.getWorker(worker); w != nil {
+		w.task = t
+	}
+	m.m.Unlock()
+	m.events.StepStart(worker.ID, t.ID, int64(t.Offset), int64(t.Len()))
+}
+func (m *Manager) FinishStep(worker *worker.Worker, t *db.Task) {
+	m.m.Lock()
+	if w := m.getWorker(worker); w != nil {
+		w.attempts = 0
+		w.task = nil
+	}
+	m.m.Unlock()
+	m.events.StepFinish(worker.ID, t.ID, int64(t.Offset), int64(t.Len()))
+}
+func (m *Manager) Do(req *http.Request) (resp *http.Response, e error) {
+	return m.conf.Do(req)
+}
+func (m *Manager) Acquire() bool {
+	return m.budget.Acquire(m.run)
+}
+func (m *Manager) Release() {
+	m.budget.Release()
+}
+func (m *Manager) Finish() <-chan struct{} {
+	return m.finish
+}
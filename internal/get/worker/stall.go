@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// StallReader cancels the request if a Read is blocked longer than timeout,
+// the time spent outside Read such as waiting for the rate limit is not counted
+type StallReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+	stalled int32
+}
+
+func NewStallReader(r io.Reader, timeout time.Duration, cancel func()) *StallReader {
+	s := &StallReader{
+		r:       r,
+		timeout: timeout,
+	}
+	if timeout > 0 {
+		s.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&s.stalled, 1)
+			cancel()
+		})
+		s.timer.Stop()
+	}
+	return s
+}
+func (s *StallReader) Read(p []byte) (n int, e error) {
+	if s.timer == nil {
+		return s.r.Read(p)
+	}
+	s.timer.Reset(s.timeout)
+	n, e = s.r.Read(p)
+	s.timer.Stop()
+	return
+}
+func (s *StallReader) Stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+}
+
+// Stalled returns true if the request was canceled by the timeout
+func (s *StallReader) Stalled() bool {
+	return atomic.LoadInt32(&s.stalled) != 0
+}
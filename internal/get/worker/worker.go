@@ -0,0 +1,381 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/db"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+)
+
+type Rely interface {
+	Context() context.Context
+	DB() *db.DB
+	GetChannel() <-chan *db.Task
+	DeleteWorker(*Worker)
+	WorkerStatus(w *Worker, str string)
+	ExitWithError(e error)
+	// Fail is called when serving a task failed, it returns true if the task should be served again.
+	// The task continues from the size recorded in the db.
+	Fail(w *Worker, e error) bool
+	WriteStatus(n int64, net bool)
+	StartStep(w *Worker, t *db.Task)
+	FinishStep(w *Worker, t *db.Task)
+	Block() utils.Size
+	// Limit waits until the total rate limit allows n bytes
+	Limit(n int) error
+	// WorkerRate returns the rate limit of every worker, 0 is unlimited
+	WorkerRate() utils.Size
+	// StallTimeout returns the duration without receiving a byte before the request is aborted, 0 is no timeout
+	StallTimeout() time.Duration
+	// Verify returns true if finished blocks should be verified by their hash before resuming
+	Verify() bool
+	Finish() <-chan struct{}
+	// Steal returns the tail split from the slowest task being downloaded, nil if no task can be split
+	Steal(w *Worker) *db.Task
+	Acquire() bool
+	Release()
+
+	GetRequest(w *Worker) (req *http.Request, e error)
+	Do(req *http.Request) (resp *http.Response, e error)
+}
+type Worker struct {
+	ID         int64
+	rely       Rely
+	m          sync.Mutex
+	statistics *utils.Statistics
+	limiter    *utils.Limiter
+	// size of the current task already passed to WriteStatus
+	reported utils.Size
+}
+
+func New(id int64, rely Rely) *Worker {
+	return &Worker{
+		ID:         id,
+		rely:       rely,
+		statistics: utils.NewStatistics(time.Second * 5),
+		limiter:    utils.NewLimiter(int64(rely.WorkerRate())),
+	}
+}
+func (w *Worker) Serve() {
+	finished := false
+	defer func() {
+		if !finished {
+			w.delete()
+		}
+	}()
+	done := w.rely.Context().Done()
+	ch := w.rely.GetChannel()
+	finish := w.rely.Finish()
+	w.postIDLE()
+	for {
+		select {
+		case <-done:
+			return
+		case <-finish:
+			// every task is served, help the slow workers
+			t := w.rely.Steal(w)
+			if t == nil {
+				finished = true
+				return
+			} else if !w.do(t) {
+				return
+			}
+		case t := <-ch:
+			if t == nil {
+				return
+			} else if !w.do(t) {
+				return
+			}
+		}
+	}
+}
+func (w *Worker) do(t *db.Task) bool {
+	if !w.rely.Acquire() {
+		return false
+	}
+	w.reported = 0
+	e := w.serve(t)
+	for e != nil && w.rely.Fail(w, e) {
+		e = w.serve(t)
+	}
+	w.rely.Release()
+	return e == nil
+}
+
+// Speed returns the download speed of the worker
+func (w *Worker) Speed() int64 {
+	w.m.Lock()
+	speed := w.statistics.Speed()
+	w.m.Unlock()
+	return speed
+}
+func (w *Worker) delete() {
+	w.rely.DeleteWorker(w)
+}
+func (w *Worker) postIDLE() {
+	w.rely.WorkerStatus(w, fmt.Sprintf(`worker-%v: IDLE`, w.ID))
+}
+func (w *Worker) postStart(t *db.Task) {
+	w.rely.WorkerStatus(w, fmt.Sprintf(`worker-%v: Start step: %v offset: %s download: 0b/%s`,
+		w.ID,
+		t.ID,
+		t.Offset, t.Len(),
+	))
+}
+func (w *Worker) postStatus(status string, t *db.Task, download utils.Size) {
+	var (
+		md  string
+		num = t.Len()
+	)
+	if download != 0 {
+		speed := w.Speed()
+		if speed != 0 {
+			md += fmt.Sprintf(` [%s/s]`, utils.Size(speed))
+			if download < num {
+				duration := time.Second * time.Duration(num-download) / time.Duration(speed)
+				md += fmt.Sprintf(` %s ETA`, duration)
+			}
+		}
+	}
+	w.rely.WorkerStatus(w, fmt.Sprintf(`worker-%v: %s step: %v offset: %s download: %s/%s%s`,
+		w.ID, status,
+		t.ID,
+		t.Offset, download, num,
+		md,
+	))
+}
+func (w *Worker) serve(t *db.Task) (e error) {
+	w.postStart(t)
+	db := w.rely.DB()
+	num, e := db.GetSize(t.ID)
+	if e != nil {
+		return
+	} else if num == t.Len() && w.rely.Verify() {
+		var ok bool
+		ok, e = db.VerifyBlock(t)
+		if e != nil {
+			return
+		} else if !ok {
+			log.Errorf(`step %v hash not matched, download again`, t.ID)
+			num = 0
+			e = db.SetSize(t.ID, 0)
+			if e != nil {
+				return
+			}
+		}
+	}
+	// the task can be split after the written size is set
+	t.Reset(num)
+	w.rely.StartStep(w, t)
+	n := t.Len()
+	if num >= 0 && num <= n && num != w.reported {
+		w.rely.WriteStatus(int64(num-w.reported), false)
+		w.reported = num
+	}
+	if num == n {
+		w.postStatus(`Finish`, t, num)
+		w.rely.FinishStep(w, t)
+		return
+	} else if num > n {
+		e = fmt.Errorf(`%v db.num(%s) > num(%s)`, t.ID, num, n)
+		return
+	} else if num < 0 {
+		e = fmt.Errorf(`%v db.num(%s) < 0`, t.ID, num)
+		return
+	}
+	// the hash of a resumed block starts from the bytes already written
+	h, e := db.HashBlock(int64(t.Offset), int64(num))
+	if e != nil {
+		return
+	}
+	f, e := os.OpenFile(db.Temp, os.O_WRONLY, 0666)
+	if e != nil {
+		return
+	}
+	_, e = f.Seek(int64(t.Offset+num), io.SeekStart)
+	if e != nil {
+		f.Close()
+		return
+	}
+	e = w.downloadRange(t, &Writer{
+		t:    t,
+		w:    w,
+		f:    f,
+		db:   db,
+		hash: h,
+		size: int64(num),
+	}, num, w.rely.Block())
+	f.Close()
+	if e == nil {
+		w.rely.FinishStep(w, t)
+	}
+	return
+}
+func (w *Worker) downloadRange(t *db.Task, writer *Writer, num, block utils.Size) (e error) {
+	w.postStatus(`Get`, t, num)
+	req, e := w.rely.GetRequest(w)
+	if e != nil {
+		return
+	}
+	url := req.URL.String()
+	offset := int64(t.Offset + num)
+	size := int64(t.Len() - num)
+	end := offset + size - 1
+	req.Header.Set(`Range`, fmt.Sprintf(`bytes=%v-%v`, offset, end))
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+	resp, e := w.rely.Do(req)
+	if e != nil {
+		e = &SourceError{URL: url, Err: e}
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && req.Header.Get(`If-Range`) != `` {
+		e = &SourceError{
+			URL:        url,
+			Err:        ErrChanged,
+			StatusCode: resp.StatusCode,
+		}
+		return
+	} else if resp.StatusCode != http.StatusPartialContent {
+		e = &SourceError{
+			URL:        url,
+			Err:        fmt.Errorf(`not StatusPartialContent: %v %v`, resp.StatusCode, resp.Status),
+			StatusCode: resp.StatusCode,
+		}
+		return
+	}
+	body := NewStallReader(resp.Body, w.rely.StallTimeout(), cancel)
+	n, e := io.Copy(writer, io.LimitReader(body, size))
+	body.Stop()
+	if e != nil {
+		if e == io.EOF && n == size {
+			e = nil
+		} else if e == errSplit {
+			// the tail is downloaded by another worker
+			e = nil
+		} else if body.Stalled() {
+			e = &SourceError{URL: url, Err: ErrStalled}
+		} else if writer.err == nil {
+			e = &SourceError{URL: url, Err: e}
+		}
+		return
+	} else if n != size && writer.size != int64(t.Len()) {
+		e = &SourceError{URL: url, Err: io.ErrUnexpectedEOF}
+		return
+	}
+	return
+}
+
+var errSplit = errors.New(`task split`)
+
+// ErrStalled is returned when no byte is received in the stall timeout
+var ErrStalled = errors.New(`no data received in the stall timeout`)
+
+// ErrChanged is returned when the server answers If-Range with the whole file because the file changed
+var ErrChanged = errors.New(`file changed on the server`)
+
+// SourceError is returned when the server of URL fails
+type SourceError struct {
+	URL string
+	Err error
+	// http status code, 0 if the request failed before a response
+	StatusCode int
+}
+
+// Temporary returns true if the request may succeed when it is retried
+func (e *SourceError) Temporary() bool {
+	switch e.StatusCode {
+	case 0, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return e.StatusCode >= 500
+}
+
+func (e *SourceError) Error() string {
+	return e.URL + `: ` + e.Err.Error()
+}
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+type Writer struct {
+	t    *db.Task
+	w    *Worker
+	f    *os.File
+	db   *db.DB
+	hash hash.Hash32
+	size int64
+	err  error
+}
+
+func (w *Writer) Write(p []byte) (n int, err error) {
+	err = w.w.limiter.Wait(w.w.rely.Context(), len(p))
+	if err == nil {
+		err = w.w.rely.Limit(len(p))
+	}
+	if err != nil {
+		w.err = err
+		return
+	}
+	if reserved := w.t.Reserve(len(p)); reserved < len(p) {
+		// the task is split, write only the bytes before the split
+		defer func() {
+			if err == nil {
+				err = errSplit
+			}
+		}()
+		p = p[:reserved]
+		if reserved == 0 {
+			return
+		}
+	}
+	n, err = w.f.Write(p)
+	if err != nil {
+		w.err = err
+		if n > 0 {
+			w.hash.Write(p[:n])
+			w.size += int64(n)
+		}
+		w.setSize()
+		return
+	}
+	if n != 0 {
+		w.hash.Write(p[:n])
+		w.w.m.Lock()
+		w.w.statistics.Push(int64(n))
+		w.w.m.Unlock()
+		w.size += int64(n)
+		err = w.setSize()
+		if err == nil {
+			w.w.rely.WriteStatus(int64(n), true)
+			w.w.reported += utils.Size(n)
+			w.update()
+		}
+	}
+	return
+}
+func (w *Writer) update() {
+	size := utils.Size(w.size)
+	if size == w.t.Len() {
+		w.w.postStatus(`Finish`, w.t, size)
+	} else {
+		w.w.postStatus(`Get`, w.t, size)
+	}
+}
+func (w *Writer) setSize() (e error) {
+	if utils.Size(w.size) == w.t.Len() {
+		return w.db.SetFinish(w.t.ID, w.size, w.hash.Sum(nil))
+	}
+	return w.db.SetSize(w.t.ID, w.size)
+}
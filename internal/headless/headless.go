@@ -0,0 +1,87 @@
+package headless
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/log"
+)
+
+const Interval = time.Second
+
+var ErrInterrupt = errors.New(`interrupt`)
+
+// Headless prints the download progress as plain lines instead of drawing a terminal ui
+type Headless struct {
+	w       io.Writer
+	prefix  string
+	m       sync.Mutex
+	status  string
+	printed string
+	exit    chan error
+	once    sync.Once
+}
+
+func New(prefix string) *Headless {
+	return &Headless{
+		w:      os.Stderr,
+		prefix: prefix,
+		exit:   make(chan error, 1),
+	}
+}
+func (h *Headless) Init() error {
+	log.SetOutput(h.w)
+	return nil
+}
+func (h *Headless) Close() {
+	h.flush()
+}
+func (h *Headless) MainLoop() (e error) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	ticker := time.NewTicker(Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.flush()
+		case <-sig:
+			e = ErrInterrupt
+			return
+		case e = <-h.exit:
+			return
+		}
+	}
+}
+func (h *Headless) SetStatus(body string) {
+	h.m.Lock()
+	h.status = body
+	h.m.Unlock()
+}
+func (h *Headless) SetWorker(body string) {
+}
+func (h *Headless) Exit(e error) {
+	h.once.Do(func() {
+		h.exit <- e
+	})
+}
+func (h *Headless) flush() {
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.status == h.printed {
+		return
+	}
+	h.printed = h.status
+	if h.prefix == `` {
+		fmt.Fprintln(h.w, h.status)
+	} else {
+		fmt.Fprintln(h.w, h.prefix, h.status)
+	}
+}
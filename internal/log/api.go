@@ -1,12 +1,17 @@
 package log
 
 import (
+	"io"
+
 	"github.com/zuiwuchang/mget/widget"
 )
 
 func Layout() error {
 	return defaultLog.Layout()
 }
+func SetOutput(w io.Writer) {
+	defaultLog.SetOutput(w)
+}
 func Display() bool {
 	return defaultLog.Display()
 }
@@ -2,6 +2,7 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -15,6 +16,7 @@ type Log struct {
 	strs         []string
 	offset, size int
 	body         string
+	output       io.Writer
 	m            sync.Mutex
 }
 
@@ -33,6 +35,11 @@ func (l *Log) Display() bool {
 	l.m.Unlock()
 	return ok
 }
+func (l *Log) SetOutput(w io.Writer) {
+	l.m.Lock()
+	l.output = w
+	l.m.Unlock()
+}
 func (l *Log) Layout() (e error) {
 	l.m.Lock()
 	defer l.m.Unlock()
@@ -96,6 +103,9 @@ func (l *Log) Trace(a ...interface{}) {
 	l.Tag(`trace`, a...)
 }
 func (l *Log) push(str string) {
+	if l.output != nil {
+		fmt.Fprintln(l.output, str)
+	}
 	strs := l.strs
 	if l.size < len(l.strs) {
 		if l.size == 0 {
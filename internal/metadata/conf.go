@@ -0,0 +1,596 @@
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	net_url "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zuiwuchang/mget/internal/checksum"
+	"github.com/zuiwuchang/mget/internal/log"
+	"github.com/zuiwuchang/mget/utils"
+	"github.com/zuiwuchang/mget/version"
+)
+
+var (
+	UserAgent  = `mget/` + version.Version + `; ` + version.Platform
+	MaxWorkers = runtime.NumCPU() * 10
+)
+
+const (
+	MismatchAsk       = `ask`
+	MismatchRestart   = `restart`
+	MismatchKeepBlock = `keep-block`
+	MismatchAbort     = `abort`
+)
+
+func CheckMismatch(mismatch string) error {
+	switch mismatch {
+	case MismatchAsk, MismatchRestart, MismatchKeepBlock, MismatchAbort:
+		return nil
+	}
+	return fmt.Errorf(`mismatch only supported ask restart keep-block or abort, not supported %s`, mismatch)
+}
+
+type Configure struct {
+	URL          string
+	Mirrors      []string
+	Output       string
+	Proxy        string
+	UserAgent    string
+	Head         bool
+	Header       http.Header
+	Cookie       []string
+	offsetCookie int
+	Insecure     bool
+	TLS          TLS
+	Transport    Transport
+	Worker       int
+	Block        utils.Size
+	m            sync.Mutex
+	client       *http.Client
+	// print the progress to stderr if no ui is set
+	Headless bool
+	Events   string
+	Checksum *checksum.Checksum
+	Verify   bool
+	// max retries of a failed request before the mirror is dropped or the download stops
+	Retry        int
+	RetryWait    time.Duration
+	RetryMaxWait time.Duration
+	// bytes per second, 0 is unlimited
+	LimitRate       utils.Size
+	LimitRateWorker utils.Size
+	// abort and retry the block request if no byte is received in the duration, 0 is no timeout
+	StallTimeout time.Duration
+	// download again from scratch if the file changed on the server while downloading
+	RestartChanged bool
+	// what to do if the downloaded data does not match the metadata when resuming
+	Mismatch string
+	// add or remove workers by the measured throughput, Worker is the initial number
+	AutoWorker bool
+	// storage backend of the resume state, bolt journal json or memory
+	Store string
+	// dirs of the temp file and the state, empty is beside Output
+	TempDir  string
+	StateDir string
+	// allocate the blocks of the temp file before downloading
+	Preallocate bool
+}
+
+func NewConfigure(url, output, proxy string,
+	agent string, head bool, headers, cookies []string, insecure bool,
+	worker int, block utils.Size,
+) (conf *Configure, e error) {
+	u, e := net_url.ParseRequestURI(url)
+	if e != nil {
+		return
+	}
+	if output == `` {
+		output = path.Base(path.Clean(u.Path))
+	}
+	if output == `` || output == `/` || output == `.` || output == `..` {
+		e = errors.New(`not supported output`)
+		return
+	}
+	if filepath.IsAbs(output) {
+		output = filepath.Clean(output)
+	} else {
+		output, e = filepath.Abs(output)
+		if e != nil {
+			return
+		}
+	}
+	if proxy != `` {
+		_, e = parseProxy(proxy)
+		if e != nil {
+			return
+		}
+	}
+
+	h := make(http.Header)
+	c := make([]string, 0, len(cookies))
+	for _, v := range cookies {
+		if v != `` {
+			c = append(c, v)
+		}
+	}
+	for _, str := range headers {
+		strs := strings.SplitN(str, `: `, 2)
+		key := textproto.CanonicalMIMEHeaderKey(strs[0])
+		var val string
+		if len(strs) == 2 {
+			val = strs[1]
+		}
+		if key == `User-Agent` {
+			if val != `` {
+				agent = val
+			}
+		} else if key == `Cookie` {
+			if val != `` {
+				c = append(c, val)
+			}
+		} else {
+			h.Add(key, val)
+		}
+	}
+
+	if agent == `` {
+		agent = UserAgent
+	}
+	if worker < 1 {
+		e = fmt.Errorf(`worker must be greater than 0, not supported %d`, worker)
+		return
+	} else if worker > MaxWorkers {
+		worker = MaxWorkers
+	}
+	if block < 1 {
+		e = fmt.Errorf(`block size must be greater than 0, not supported %s`, block)
+		return
+	}
+
+	conf = &Configure{
+		URL:       url,
+		Output:    output,
+		Proxy:     proxy,
+		UserAgent: agent,
+		Head:      head,
+		Header:    h,
+		Cookie:    c,
+		Insecure:  insecure,
+		Transport: DefaultTransport(),
+		Worker:    worker,
+		Block:     block,
+	}
+	return
+}
+func (c *Configure) String() string {
+	var w bytes.Buffer
+	c.WriteFormat(&w, ``)
+	return w.String()
+}
+func (c *Configure) WriteFormat(w io.Writer, prefix string) (n int, e error) {
+	num, e := fmt.Fprintln(w, prefix+`      URL:`, c.URL)
+	if e != nil {
+		return
+	}
+	n += num
+	for _, mirror := range c.Mirrors {
+		num, e = fmt.Fprintln(w, prefix+`   Mirror:`, mirror)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	num, e = fmt.Fprintln(w, prefix+`   Output:`, c.Output)
+	if e != nil {
+		return
+	}
+	n += num
+	if c.TempDir != `` {
+		num, e = fmt.Fprintln(w, prefix+`  TempDir:`, c.TempDir)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	if c.StateDir != `` {
+		num, e = fmt.Fprintln(w, prefix+` StateDir:`, c.StateDir)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+
+	num, e = fmt.Fprint(w, prefix+`     Head: `, c.Head)
+	if e != nil {
+		return
+	}
+	n += num
+	num, e = fmt.Fprint(w, `  Insecure: `, c.Insecure)
+	if e != nil {
+		return
+	}
+	n += num
+	num, e = fmt.Fprint(w, `  Worker: `, c.Worker)
+	if e != nil {
+		return
+	}
+	n += num
+	if c.AutoWorker {
+		num, e = fmt.Fprint(w, ` auto`)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	num, e = fmt.Fprint(w, ` Block: `, c.Block)
+	if e != nil {
+		return
+	}
+	n += num
+	num, e = fmt.Fprintln(w, `  Store:`, c.Store)
+	if e != nil {
+		return
+	}
+	n += num
+
+	num, e = fmt.Fprintln(w, prefix+`    Proxy:`, ProxiesFromEnvironment(c.Proxy))
+	if e != nil {
+		return
+	}
+	n += num
+	if !c.TLS.IsZero() {
+		num, e = fmt.Fprintln(w, prefix+`      TLS:`, &c.TLS)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	num, e = fmt.Fprintln(w, prefix+`UserAgent:`, c.UserAgent)
+	if e != nil {
+		return
+	}
+	n += num
+	if c.Retry > 0 {
+		num, e = fmt.Fprintf(w, prefix+"    Retry: %v  Wait: %v  MaxWait: %v\n", c.Retry, c.RetryWait, c.RetryMaxWait)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	if c.LimitRate != 0 || c.LimitRateWorker != 0 {
+		num, e = fmt.Fprintf(w, prefix+"    Limit: %s/s  Worker: %s/s\n", c.LimitRate, c.LimitRateWorker)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	if c.Checksum != nil {
+		num, e = fmt.Fprintln(w, prefix+` Checksum:`, c.Checksum)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+
+	if len(c.Header) != 0 {
+		num, e = fmt.Fprintln(w, prefix+`   Header: [`)
+		if e != nil {
+			return
+		}
+		n += num
+		for k, v := range c.Header {
+			num, e = fmt.Fprintf(w, "   "+prefix+prefix+`%s = [`, k)
+			if e != nil {
+				return
+			}
+			n += num
+			for i, s := range v {
+				if i == 0 {
+					num, e = fmt.Fprintf(w, "%q", s)
+					if e != nil {
+						return
+					}
+					n += num
+				} else {
+					num, e = fmt.Fprintf(w, ",%q", s)
+					if e != nil {
+						return
+					}
+					n += num
+				}
+			}
+			num, e = fmt.Fprintln(w, `]`)
+			if e != nil {
+				return
+			}
+			n += num
+		}
+		num, e = fmt.Fprintln(w, prefix+`]`)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	if len(c.Cookie) != 0 {
+		num, e = fmt.Fprintln(w, prefix+`   Cookie: [`)
+		if e != nil {
+			return
+		}
+		n += num
+		for _, v := range c.Cookie {
+			num, e = fmt.Fprintln(w, `   `+prefix+prefix, v)
+			if e != nil {
+				return
+			}
+			n += num
+		}
+		num, e = fmt.Fprintln(w, prefix+`]`)
+		if e != nil {
+			return
+		}
+		n += num
+	}
+	return
+}
+func (c *Configure) Println() {
+	c.Fprintln(os.Stdout)
+}
+func (c *Configure) Fprintln(w io.Writer) {
+	fmt.Fprintln(w, `Configure {`)
+	c.WriteFormat(w, `   `)
+	fmt.Fprintln(w, `}`)
+}
+func (c *Configure) Do(req *http.Request) (*http.Response, error) {
+	client, e := c.Client()
+	if e != nil {
+		return nil, e
+	}
+	return client.Do(req)
+}
+
+// Remote is the file information reported by the server
+type Remote struct {
+	Modified string
+	ETag     string
+	// -1 if the server does not report the size
+	Size int64
+	// the server supports range requests
+	Range bool
+}
+
+// IfRange returns the validator sent in If-Range, a weak ETag cannot be used so Last-Modified is used instead
+func (r *Remote) IfRange() string {
+	if r.ETag != `` && !strings.HasPrefix(r.ETag, `W/`) {
+		return r.ETag
+	}
+	return r.Modified
+}
+
+// AddMirror adds a url which serves the same file as URL
+func (c *Configure) AddMirror(url string) (e error) {
+	_, e = net_url.ParseRequestURI(url)
+	if e != nil {
+		return
+	}
+	c.Mirrors = append(c.Mirrors, url)
+	return
+}
+
+// Match returns an error if the other mirror does not serve the same file
+func (r *Remote) Match(other *Remote) error {
+	if r.Size != other.Size {
+		return fmt.Errorf(`size not matched: %v != %v`, other.Size, r.Size)
+	} else if r.Modified != `` && other.Modified != `` && r.Modified != other.Modified {
+		return fmt.Errorf(`Last-Modified not matched: %s != %s`, other.Modified, r.Modified)
+	} else if r.ETag != `` && other.ETag != `` && r.ETag != other.ETag {
+		return fmt.Errorf(`ETag not matched: %s != %s`, other.ETag, r.ETag)
+	} else if r.Range != other.Range {
+		return errors.New(`range requests not supported`)
+	}
+	return nil
+}
+func (c *Configure) GetMetadata(ctx context.Context, url string) (remote *Remote, e error) {
+	if c.Head {
+		remote, e = c.head(ctx, url)
+		if e != nil || remote.Range {
+			return
+		}
+		log.Info(`Accept-Ranges or Content-Length not found, probe range request`)
+	}
+	return c.probe(ctx, url)
+}
+func (c *Configure) head(ctx context.Context, url string) (remote *Remote, e error) {
+	req, e := c.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if e != nil {
+		return
+	}
+	log.Info(req.Method, ` `, req.URL)
+	resp, e := c.Do(req)
+	if e != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e = fmt.Errorf(`not StatusOK: %v`, resp.Status)
+		return
+	}
+	remote = &Remote{
+		Modified: resp.Header.Get(`Last-Modified`),
+		ETag:     resp.Header.Get(`ETag`),
+		Size:     -1,
+	}
+	size, err := strconv.ParseInt(resp.Header.Get(`Content-Length`), 10, 64)
+	if err == nil && size >= 0 {
+		remote.Size = size
+		remote.Range = resp.Header.Get(`Accept-Ranges`) == `bytes`
+	}
+	return
+}
+
+// probe sends 'Range: bytes=0-0' because many servers support range requests without Accept-Ranges
+func (c *Configure) probe(ctx context.Context, url string) (remote *Remote, e error) {
+	req, e := c.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if e != nil {
+		return
+	}
+	req.Header.Set(`Range`, `bytes=0-0`)
+	log.Info(req.Method, ` `, req.URL, ` Range: bytes=0-0`)
+	resp, e := c.Do(req)
+	if e != nil {
+		return
+	}
+	resp.Body.Close()
+	remote = &Remote{
+		Modified: resp.Header.Get(`Last-Modified`),
+		ETag:     resp.Header.Get(`ETag`),
+		Size:     -1,
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// bytes 0-0/size
+		str := resp.Header.Get(`Content-Range`)
+		i := strings.LastIndex(str, `/`)
+		if i < 0 {
+			e = fmt.Errorf(`invalid Content-Range: %s`, str)
+			return
+		}
+		size, err := strconv.ParseInt(str[i+1:], 10, 64)
+		if err == nil && size >= 0 {
+			remote.Size = size
+			remote.Range = true
+		}
+	case http.StatusOK:
+		remote.Size = resp.ContentLength
+	default:
+		e = fmt.Errorf(`not StatusOK: %v`, resp.Status)
+		return
+	}
+	return
+}
+
+// GetChecksum reads the expected digest from the checksum sidecar url
+func (c *Configure) GetChecksum(ctx context.Context) (e error) {
+	if c.Checksum == nil || c.Checksum.URL == `` {
+		return
+	}
+	req, e := c.NewRequestWithContext(ctx, http.MethodGet, c.Checksum.URL, nil)
+	if e != nil {
+		return
+	}
+	log.Info(req.Method, ` `, req.URL)
+	resp, e := c.Do(req)
+	if e != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e = fmt.Errorf(`get checksum not StatusOK: %v`, resp.Status)
+		return
+	}
+	b, e := io.ReadAll(io.LimitReader(resp.Body, utils.M*4))
+	if e != nil {
+		return
+	}
+	u, e := net_url.Parse(c.URL)
+	if e != nil {
+		return
+	}
+	e = c.Checksum.ReadSidecar(bytes.NewReader(b), path.Base(u.Path))
+	if e != nil {
+		if name := filepath.Base(c.Output); name != path.Base(u.Path) &&
+			c.Checksum.ReadSidecar(bytes.NewReader(b), name) == nil {
+			e = nil
+		}
+	}
+	return
+}
+func (c *Configure) NewRequestWithContext(ctx context.Context, method, url string, body io.Reader) (req *http.Request, e error) {
+	req, e = http.NewRequestWithContext(ctx, method, url, body)
+	if e != nil {
+		return
+	}
+	header := req.Header
+	for m, k := range c.Header {
+		header[m] = k
+	}
+	header.Set(`User-Agent`, c.UserAgent)
+	cookie := c.cookie()
+	if cookie != `` {
+		header.Set(`Cookie`, cookie)
+	}
+	return
+}
+func (c *Configure) cookie() string {
+	if len(c.Cookie) == 0 {
+		return ``
+	}
+	c.m.Lock()
+	v := c.Cookie[c.offsetCookie]
+	c.offsetCookie++
+	if c.offsetCookie >= len(c.Cookie) {
+		c.offsetCookie = 0
+	}
+	c.m.Unlock()
+	return v
+}
+func (c *Configure) Exists() (exists bool, e error) {
+	info, e := os.Stat(c.Output)
+	if e != nil {
+		if os.IsNotExist(e) {
+			e = nil
+		}
+		return
+	}
+	exists = true
+	if info.IsDir() {
+		e = fmt.Errorf(`dir already exists: %s`, c.Output)
+		return
+	}
+	return
+}
+
+// SetClient makes c share client with other configures so that connections can be reused
+func (c *Configure) SetClient(client *http.Client) {
+	c.m.Lock()
+	c.client = client
+	c.m.Unlock()
+}
+func (c *Configure) Client() (client *http.Client, e error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.client != nil {
+		client = c.client
+		return
+	}
+	tls, e := c.TLS.Config(c.Insecure)
+	if e != nil {
+		return
+	}
+	proxyTLS, e := c.TLS.ProxyConfig()
+	if e != nil {
+		return
+	}
+	u, e := net_url.Parse(c.URL)
+	if e != nil {
+		return
+	}
+	client = &http.Client{
+		Transport: newProxyTransport(ProxiesFromEnvironment(c.Proxy), tls, proxyTLS, u.Hostname(), c.Transport),
+	}
+	c.client = client
+	return
+}
@@ -0,0 +1,96 @@
+package metadata
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	net_url "net/url"
+	"time"
+)
+
+// connectDialer tunnels through an https proxy by CONNECT.
+// The proxy handshake has its own tls config, the tls options of the origin are only used inside the tunnel.
+type connectDialer struct {
+	// address of the proxy
+	address string
+	auth    string
+	tls     *tls.Config
+	// dials the proxy
+	forward *net.Dialer
+}
+
+func newConnectDialer(p *net_url.URL, config *tls.Config, forward *net.Dialer) *connectDialer {
+	address := p.Host
+	if p.Port() == `` {
+		address = net.JoinHostPort(p.Hostname(), `443`)
+	}
+	if config == nil {
+		config = &tls.Config{}
+	} else {
+		config = config.Clone()
+	}
+	if config.ServerName == `` {
+		config.ServerName = p.Hostname()
+	}
+	d := &connectDialer{
+		address: address,
+		tls:     config,
+		forward: forward,
+	}
+	if p.User != nil {
+		password, _ := p.User.Password()
+		d.auth = `Basic ` + base64.StdEncoding.EncodeToString([]byte(p.User.Username()+`:`+password))
+	}
+	return d
+}
+func (d *connectDialer) DialContext(ctx context.Context, network, addr string) (c net.Conn, e error) {
+	raw, e := d.forward.DialContext(ctx, `tcp`, d.address)
+	if e != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		raw.SetDeadline(deadline)
+	} else {
+		raw.SetDeadline(time.Now().Add(time.Second * 30))
+	}
+	conn := tls.Client(raw, d.tls)
+	e = conn.Handshake()
+	if e == nil {
+		e = d.connect(conn, addr)
+	}
+	if e != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	c = conn
+	return
+}
+func (d *connectDialer) connect(c net.Conn, addr string) (e error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &net_url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if d.auth != `` {
+		req.Header.Set(`Proxy-Authorization`, d.auth)
+	}
+	e = req.Write(c)
+	if e != nil {
+		return
+	}
+	resp, e := http.ReadResponse(bufio.NewReader(c), req)
+	if e != nil {
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		e = fmt.Errorf(`proxy %s rejected CONNECT %s: %s`, d.address, addr, resp.Status)
+	}
+	return
+}
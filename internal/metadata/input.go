@@ -0,0 +1,55 @@
+package metadata
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Input is a download parsed from an input file
+type Input struct {
+	URL    string
+	Output string
+	Header []string
+}
+
+// ReadInput parses an input file.
+//
+// Each download starts with a line 'URL [output]',
+// the indented lines following it are http headers 'key: value' of that download.
+// Empty lines and lines starting with # are ignored.
+func ReadInput(r io.Reader) (inputs []Input, e error) {
+	var (
+		scanner = bufio.NewScanner(r)
+		line    int
+	)
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		str := strings.TrimSpace(text)
+		if str == `` || strings.HasPrefix(str, `#`) {
+			continue
+		}
+		if text[0] == ' ' || text[0] == '\t' {
+			if len(inputs) == 0 {
+				e = fmt.Errorf(`input line %v: header without url`, line)
+				return
+			}
+			current := &inputs[len(inputs)-1]
+			current.Header = append(current.Header, str)
+			continue
+		}
+		var input Input
+		i := strings.IndexAny(str, " \t")
+		if i < 0 {
+			input.URL = str
+		} else {
+			input.URL = str[:i]
+			input.Output = strings.TrimSpace(str[i+1:])
+		}
+		inputs = append(inputs, input)
+	}
+	e = scanner.Err()
+	return
+}
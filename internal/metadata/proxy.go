@@ -0,0 +1,269 @@
+package metadata
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	net_url "net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Proxies selects the proxy of a url like curl, the explicit proxy is used for every scheme,
+// otherwise the proxy of the url scheme or all_proxy is read from the environment. The hosts in no_proxy are connected directly.
+type Proxies struct {
+	// set by the command line or the config file
+	Proxy   string
+	HTTP    string
+	HTTPS   string
+	All     string
+	NoProxy string
+
+	noProxy []noProxy
+}
+
+// ProxiesFromEnvironment reads http_proxy https_proxy all_proxy and no_proxy, the lowercase name is used first.
+// socket_proxy is used if all_proxy is not set.
+func ProxiesFromEnvironment(explicit string) *Proxies {
+	p := &Proxies{
+		Proxy:   explicit,
+		HTTP:    getenv(`http_proxy`),
+		HTTPS:   getenv(`https_proxy`),
+		All:     getenv(`all_proxy`),
+		NoProxy: getenv(`no_proxy`),
+	}
+	if p.All == `` {
+		p.All = getenv(`socket_proxy`)
+	}
+	p.noProxy = parseNoProxy(p.NoProxy)
+	return p
+}
+func getenv(key string) string {
+	if v := os.Getenv(key); v != `` {
+		return v
+	}
+	return os.Getenv(strings.ToUpper(key))
+}
+
+// URL returns the proxy of the url, nil is a direct connection
+func (p *Proxies) URL(u *net_url.URL) (*net_url.URL, error) {
+	proxy := p.Proxy
+	if proxy == `` {
+		switch u.Scheme {
+		case `http`:
+			proxy = p.HTTP
+		case `https`:
+			proxy = p.HTTPS
+		}
+		if proxy == `` {
+			proxy = p.All
+		}
+	}
+	if proxy == `` || p.bypass(u) {
+		return nil, nil
+	}
+	return parseProxy(proxy)
+}
+
+// parseProxy parses the proxy url, http is used if the scheme is not set like curl
+func parseProxy(proxy string) (*net_url.URL, error) {
+	if !strings.Contains(proxy, `://`) {
+		proxy = `http://` + proxy
+	}
+	u, e := net_url.Parse(proxy)
+	if e != nil {
+		return nil, e
+	}
+	switch u.Scheme {
+	case `http`, `https`, `socks5`, `socks5h`, `socks4`, `socks4a`:
+	default:
+		return nil, fmt.Errorf(`proxy only supported http https socks5 socks5h socks4 or socks4a, not supported %s`, u.Scheme)
+	}
+	return u, nil
+}
+
+// redactProxy hides the password of the proxy
+func redactProxy(proxy string) string {
+	u, e := parseProxy(proxy)
+	if e != nil || u.User == nil {
+		return proxy
+	}
+	if _, ok := u.User.Password(); !ok {
+		return proxy
+	}
+	return u.Redacted()
+}
+func (p *Proxies) bypass(u *net_url.URL) bool {
+	if len(p.noProxy) == 0 {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == `` {
+		if u.Scheme == `https` {
+			port = `443`
+		} else {
+			port = `80`
+		}
+	}
+	ip := net.ParseIP(host)
+	for _, node := range p.noProxy {
+		if node.match(host, port, ip) {
+			return true
+		}
+	}
+	return false
+}
+func (p *Proxies) String() string {
+	strs := make([]string, 0, 4)
+	if p.Proxy != `` {
+		strs = append(strs, redactProxy(p.Proxy))
+	} else {
+		if p.HTTP != `` {
+			strs = append(strs, `http=`+redactProxy(p.HTTP))
+		}
+		if p.HTTPS != `` {
+			strs = append(strs, `https=`+redactProxy(p.HTTPS))
+		}
+		if p.All != `` {
+			strs = append(strs, `all=`+redactProxy(p.All))
+		}
+	}
+	if len(strs) != 0 && p.NoProxy != `` {
+		strs = append(strs, `no=`+p.NoProxy)
+	}
+	return strings.Join(strs, ` `)
+}
+
+// noProxy is an entry of no_proxy: * a domain and its subdomains, an ip, a cidr, optionally with a port
+type noProxy struct {
+	all    bool
+	domain string
+	ip     net.IP
+	cidr   *net.IPNet
+	port   string
+}
+
+func parseNoProxy(str string) (nodes []noProxy) {
+	for _, s := range strings.Split(str, `,`) {
+		s = strings.ToLower(strings.TrimSpace(s))
+		if s == `` {
+			continue
+		} else if s == `*` {
+			nodes = append(nodes, noProxy{all: true})
+			continue
+		}
+		if _, cidr, e := net.ParseCIDR(s); e == nil {
+			nodes = append(nodes, noProxy{cidr: cidr})
+			continue
+		}
+		var node noProxy
+		if host, port, e := net.SplitHostPort(s); e == nil {
+			s, node.port = host, port
+		}
+		s = strings.TrimPrefix(s, `[`)
+		s = strings.TrimSuffix(s, `]`)
+		if ip := net.ParseIP(s); ip != nil {
+			node.ip = ip
+		} else {
+			node.domain = strings.TrimPrefix(strings.TrimPrefix(s, `*`), `.`)
+			if node.domain == `` {
+				continue
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return
+}
+func (n *noProxy) match(host, port string, ip net.IP) bool {
+	if n.all {
+		return true
+	} else if n.port != `` && n.port != port {
+		return false
+	}
+	if n.cidr != nil {
+		return ip != nil && n.cidr.Contains(ip)
+	} else if n.ip != nil {
+		return ip != nil && n.ip.Equal(ip)
+	}
+	return host == n.domain || strings.HasSuffix(host, `.`+n.domain)
+}
+
+// proxyTransport sends every request by the transport of its proxy.
+// tls is the config of the origin servers, proxyTLS is the config of the https proxies and nil uses the system CAs.
+// The ServerName of tls is only sent to host, the host of the primary url, mirrors sidecars and redirects use their own host.
+type proxyTransport struct {
+	proxies    *Proxies
+	tls        *tls.Config
+	proxyTLS   *tls.Config
+	host       string
+	options    Transport
+	m          sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newProxyTransport(proxies *Proxies, tls, proxyTLS *tls.Config, host string, options Transport) *proxyTransport {
+	return &proxyTransport{
+		proxies:    proxies,
+		tls:        tls,
+		proxyTLS:   proxyTLS,
+		host:       host,
+		options:    options,
+		transports: make(map[string]*http.Transport),
+	}
+}
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p, e := t.proxies.URL(req.URL)
+	if e != nil {
+		return nil, e
+	}
+	sni := t.tls != nil && t.tls.ServerName != `` && strings.EqualFold(req.URL.Hostname(), t.host)
+	transport, e := t.transport(p, sni)
+	if e != nil {
+		return nil, e
+	}
+	return transport.RoundTrip(req)
+}
+func (t *proxyTransport) transport(p *net_url.URL, sni bool) (transport *http.Transport, e error) {
+	key := ``
+	if p != nil {
+		key = p.String()
+	}
+	if sni {
+		key = `sni ` + key
+	}
+	t.m.Lock()
+	defer t.m.Unlock()
+	transport = t.transports[key]
+	if transport != nil {
+		return
+	}
+	dialer := t.options.dialer()
+	transport = t.options.newTransport(dialer)
+	if t.tls != nil {
+		transport.TLSClientConfig = t.tls.Clone()
+		if !sni {
+			transport.TLSClientConfig.ServerName = ``
+		}
+	}
+	if p != nil {
+		switch p.Scheme {
+		case `http`:
+			transport.Proxy = http.ProxyURL(p)
+		case `https`:
+			// net/http would handshake with the proxy by the tls config of the origin
+			transport.DialContext = newConnectDialer(p, t.proxyTLS, dialer).DialContext
+		case `socks5`, `socks5h`, `socks4`, `socks4a`:
+			var socks *socksDialer
+			socks, e = newSocksDialer(p, dialer)
+			if e != nil {
+				return
+			}
+			transport.DialContext = socks.DialContext
+		}
+	}
+	t.transports[key] = transport
+	return
+}
@@ -0,0 +1,392 @@
+package metadata
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	net_url "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNoProxy(t *testing.T) {
+	tests := []struct {
+		noProxy string
+		url     string
+		bypass  bool
+	}{
+		{`*`, `http://example.com/a`, true},
+		{`*`, `https://10.0.0.1:8443/a`, true},
+		{``, `http://example.com/a`, false},
+		{` , `, `http://example.com/a`, false},
+
+		{`example.com`, `http://example.com/a`, true},
+		{`example.com`, `http://www.example.com/a`, true},
+		{`example.com`, `http://EXAMPLE.com/a`, true},
+		{`example.com`, `http://badexample.com/a`, false},
+		{`example.com`, `http://example.com.cn/a`, false},
+		{`.example.com`, `http://example.com/a`, true},
+		{`.example.com`, `http://www.example.com/a`, true},
+		{`*.example.com`, `http://www.example.com/a`, true},
+		{`*.example.com`, `http://badexample.com/a`, false},
+		{`other.com, example.com`, `http://www.example.com/a`, true},
+		{`other.com,EXAMPLE.COM`, `http://example.com/a`, true},
+
+		{`example.com:8080`, `http://example.com:8080/a`, true},
+		{`example.com:8080`, `http://example.com/a`, false},
+		{`example.com:80`, `http://example.com/a`, true},
+		{`example.com:443`, `https://example.com/a`, true},
+		{`example.com:443`, `http://example.com/a`, false},
+
+		{`192.168.1.10`, `http://192.168.1.10/a`, true},
+		{`192.168.1.10`, `http://192.168.1.11/a`, false},
+		{`192.168.1.10:8080`, `http://192.168.1.10:8080/a`, true},
+		{`192.168.1.10:8080`, `http://192.168.1.10:9090/a`, false},
+		{`192.168.0.0/16`, `http://192.168.1.10/a`, true},
+		{`192.168.0.0/16`, `http://192.169.1.10/a`, false},
+		{`192.168.0.0/16`, `http://example.com/a`, false},
+		{`10.0.0.0/8`, `https://10.1.2.3:8443/a`, true},
+
+		{`::1`, `http://[::1]:8080/a`, true},
+		{`[::1]`, `http://[::1]/a`, true},
+		{`[::1]:8080`, `http://[::1]:8080/a`, true},
+		{`[::1]:8080`, `http://[::1]:9090/a`, false},
+		{`fd00::/8`, `http://[fd12::1]/a`, true},
+		{`fd00::/8`, `http://[fe80::1]/a`, false},
+		{`0:0:0:0:0:0:0:1`, `http://[::1]/a`, true},
+		{`127.0.0.1`, `http://[::1]/a`, false},
+	}
+	for _, test := range tests {
+		p := &Proxies{
+			Proxy:   `http://127.0.0.1:3128`,
+			NoProxy: test.noProxy,
+			noProxy: parseNoProxy(test.noProxy),
+		}
+		u, e := net_url.Parse(test.url)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if bypass := p.bypass(u); bypass != test.bypass {
+			t.Errorf(`no_proxy %q %s: expected bypass %v got %v`, test.noProxy, test.url, test.bypass, bypass)
+		}
+		proxy, e := p.URL(u)
+		if e != nil {
+			t.Errorf(`no_proxy %q %s: %v`, test.noProxy, test.url, e)
+		} else if (proxy == nil) != test.bypass {
+			t.Errorf(`no_proxy %q %s: expected bypass %v got proxy %v`, test.noProxy, test.url, test.bypass, proxy)
+		}
+	}
+}
+func TestProxiesURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		p     Proxies
+		url   string
+		proxy string
+	}{
+		{`direct`, Proxies{}, `http://example.com`, ``},
+		{`explicit http`, Proxies{Proxy: `socks5://127.0.0.1:1080`, HTTP: `http://127.0.0.1:1`}, `http://example.com`, `socks5://127.0.0.1:1080`},
+		{`explicit https`, Proxies{Proxy: `socks5://127.0.0.1:1080`, HTTPS: `http://127.0.0.1:1`}, `https://example.com`, `socks5://127.0.0.1:1080`},
+		{`http`, Proxies{HTTP: `http://127.0.0.1:1`, HTTPS: `http://127.0.0.1:2`, All: `http://127.0.0.1:3`}, `http://example.com`, `http://127.0.0.1:1`},
+		{`https`, Proxies{HTTP: `http://127.0.0.1:1`, HTTPS: `http://127.0.0.1:2`, All: `http://127.0.0.1:3`}, `https://example.com`, `http://127.0.0.1:2`},
+		{`http to all`, Proxies{HTTPS: `http://127.0.0.1:2`, All: `http://127.0.0.1:3`}, `http://example.com`, `http://127.0.0.1:3`},
+		{`https to all`, Proxies{HTTP: `http://127.0.0.1:1`, All: `socks5h://127.0.0.1:3`}, `https://example.com`, `socks5h://127.0.0.1:3`},
+		{`http only`, Proxies{HTTP: `http://127.0.0.1:1`}, `https://example.com`, ``},
+		{`default scheme`, Proxies{HTTP: `127.0.0.1:1`}, `http://example.com`, `http://127.0.0.1:1`},
+		{`https proxy`, Proxies{HTTPS: `https://127.0.0.1:2`}, `https://example.com`, `https://127.0.0.1:2`},
+	}
+	for _, test := range tests {
+		u, e := net_url.Parse(test.url)
+		if e != nil {
+			t.Fatal(e)
+		}
+		proxy, e := test.p.URL(u)
+		if e != nil {
+			t.Errorf(`%s: %v`, test.name, e)
+			continue
+		}
+		var str string
+		if proxy != nil {
+			str = proxy.String()
+		}
+		if str != test.proxy {
+			t.Errorf(`%s: expected %q got %q`, test.name, test.proxy, str)
+		}
+	}
+
+	p := &Proxies{Proxy: `ftp://127.0.0.1:21`}
+	u, _ := net_url.Parse(`http://example.com`)
+	if _, e := p.URL(u); e == nil {
+		t.Errorf(`ftp proxy: expected error`)
+	}
+}
+func TestProxiesFromEnvironment(t *testing.T) {
+	keys := []string{`http_proxy`, `https_proxy`, `all_proxy`, `socket_proxy`, `no_proxy`}
+	saved := make(map[string]*string)
+	for _, key := range keys {
+		for _, k := range []string{key, strings.ToUpper(key)} {
+			if v, ok := os.LookupEnv(k); ok {
+				saved[k] = &v
+			} else {
+				saved[k] = nil
+			}
+			os.Unsetenv(k)
+		}
+	}
+	defer func() {
+		for k, v := range saved {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}()
+
+	os.Setenv(`http_proxy`, `http://127.0.0.1:1`)
+	os.Setenv(`HTTP_PROXY`, `http://127.0.0.1:9`)
+	os.Setenv(`HTTPS_PROXY`, `http://127.0.0.1:2`)
+	os.Setenv(`SOCKET_PROXY`, `socks5://127.0.0.1:3`)
+	os.Setenv(`NO_PROXY`, `.local, 10.0.0.0/8`)
+	p := ProxiesFromEnvironment(``)
+	if p.HTTP != `http://127.0.0.1:1` {
+		t.Errorf(`http_proxy: the lowercase name is not used first: %s`, p.HTTP)
+	}
+	if p.HTTPS != `http://127.0.0.1:2` {
+		t.Errorf(`HTTPS_PROXY: %s`, p.HTTPS)
+	}
+	if p.All != `socks5://127.0.0.1:3` {
+		t.Errorf(`socket_proxy is not used without all_proxy: %s`, p.All)
+	}
+	tests := []struct {
+		url   string
+		proxy string
+	}{
+		{`http://example.com`, `http://127.0.0.1:1`},
+		{`https://example.com`, `http://127.0.0.1:2`},
+		{`ftp://example.com`, `socks5://127.0.0.1:3`},
+		{`http://nas.local`, ``},
+		{`https://10.1.2.3`, ``},
+	}
+	for _, test := range tests {
+		u, e := net_url.Parse(test.url)
+		if e != nil {
+			t.Fatal(e)
+		}
+		proxy, e := p.URL(u)
+		if e != nil {
+			t.Errorf(`%s: %v`, test.url, e)
+			continue
+		}
+		var str string
+		if proxy != nil {
+			str = proxy.String()
+		}
+		if str != test.proxy {
+			t.Errorf(`%s: expected %q got %q`, test.url, test.proxy, str)
+		}
+	}
+
+	os.Setenv(`all_proxy`, `http://127.0.0.1:4`)
+	if p = ProxiesFromEnvironment(`http://127.0.0.1:5`); p.All != `http://127.0.0.1:4` || p.Proxy != `http://127.0.0.1:5` {
+		t.Errorf(`all_proxy: %s explicit: %s`, p.All, p.Proxy)
+	}
+}
+func TestHTTPSProxy(t *testing.T) {
+	var (
+		m          sync.Mutex
+		originSNI  string
+		proxySNI   []string
+		proxyAuth  []string
+		proxyHosts []string
+	)
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		originSNI = r.TLS.ServerName
+		m.Unlock()
+		io.WriteString(w, `origin`)
+	}))
+	defer origin.Close()
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `plain`)
+	}))
+	defer plain.Close()
+
+	// the proxy has another certificate than the origin, so the pin of the origin does not match it
+	proxyCert := newCertificate(t)
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		proxySNI = append(proxySNI, r.TLS.ServerName)
+		proxyAuth = append(proxyAuth, r.Header.Get(`Proxy-Authorization`))
+		proxyHosts = append(proxyHosts, r.Host)
+		m.Unlock()
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		dst, e := net.Dial(`tcp`, r.Host)
+		if e != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		c, _, e := w.(http.Hijacker).Hijack()
+		if e != nil {
+			dst.Close()
+			return
+		}
+		c.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		go func() {
+			io.Copy(dst, c)
+			dst.Close()
+		}()
+		io.Copy(c, dst)
+		c.Close()
+	}))
+	proxy.TLS = &tls.Config{Certificates: []tls.Certificate{proxyCert}}
+	// the last request fails the handshake
+	proxy.Config.ErrorLog = log.New(io.Discard, ``, 0)
+	proxy.StartTLS()
+	defer proxy.Close()
+
+	cacert := filepath.Join(t.TempDir(), `proxy.pem`)
+	e := os.WriteFile(cacert, pem.EncodeToMemory(&pem.Block{Type: `CERTIFICATE`, Bytes: proxyCert.Leaf.Raw}), 0600)
+	if e != nil {
+		t.Fatal(e)
+	}
+	proxyURL, e := net_url.Parse(proxy.URL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	proxyURL.User = net_url.UserPassword(`king`, `cerberus`)
+	sum := sha256.Sum256(origin.Certificate().RawSubjectPublicKeyInfo)
+	conf := &Configure{
+		URL:   origin.URL,
+		Proxy: proxyURL.String(),
+		// the certificate of the origin is not signed for origin.test
+		Insecure: true,
+		TLS: TLS{
+			ServerName:  `origin.test`,
+			Pin:         []string{`sha256//` + base64.StdEncoding.EncodeToString(sum[:])},
+			ProxyCACert: cacert,
+		},
+		Transport: DefaultTransport(),
+	}
+	client, e := conf.Client()
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, test := range []struct {
+		url  string
+		body string
+	}{
+		{origin.URL, `origin`},
+		{plain.URL, `plain`},
+	} {
+		resp, e := client.Get(test.url)
+		if e != nil {
+			t.Fatal(e)
+		}
+		b, e := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if e != nil {
+			t.Fatal(e)
+		} else if string(b) != test.body {
+			t.Fatalf(`%s: expected %q got %q`, test.url, test.body, b)
+		}
+	}
+
+	m.Lock()
+	if originSNI != `origin.test` {
+		t.Errorf(`sni of the origin: expected origin.test got %q`, originSNI)
+	}
+	auth := `Basic ` + base64.StdEncoding.EncodeToString([]byte(`king:cerberus`))
+	hosts := []string{strings.TrimPrefix(origin.URL, `https://`), strings.TrimPrefix(plain.URL, `http://`)}
+	if len(proxySNI) != len(hosts) {
+		m.Unlock()
+		t.Fatalf(`expected %v CONNECT got %v`, len(hosts), len(proxySNI))
+	}
+	for i, host := range hosts {
+		if proxySNI[i] == `origin.test` {
+			t.Errorf(`sni of the origin is sent to the proxy`)
+		}
+		if proxyAuth[i] != auth {
+			t.Errorf(`Proxy-Authorization: expected %q got %q`, auth, proxyAuth[i])
+		}
+		if proxyHosts[i] != host {
+			t.Errorf(`CONNECT: expected %s got %s`, host, proxyHosts[i])
+		}
+	}
+	m.Unlock()
+
+	// the proxy is verified by its own tls config
+	conf = &Configure{
+		Proxy:     proxy.URL,
+		Insecure:  true,
+		TLS:       TLS{ServerName: `origin.test`},
+		Transport: DefaultTransport(),
+	}
+	if client, e = conf.Client(); e != nil {
+		t.Fatal(e)
+	} else if _, e = client.Get(origin.URL); e == nil {
+		t.Errorf(`the certificate of the proxy is not verified`)
+	}
+	conf = &Configure{
+		Proxy:     proxy.URL,
+		Insecure:  true,
+		TLS:       TLS{ProxyInsecure: true},
+		Transport: DefaultTransport(),
+	}
+	if client, e = conf.Client(); e != nil {
+		t.Fatal(e)
+	} else if _, e = client.Get(origin.URL); e != nil {
+		t.Errorf(`proxy-insecure: %v`, e)
+	}
+}
+
+// newCertificate returns a self-signed certificate of 127.0.0.1
+func newCertificate(t *testing.T) tls.Certificate {
+	key, e := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if e != nil {
+		t.Fatal(e)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: `proxy`},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP(`127.0.0.1`)},
+	}
+	der, e := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if e != nil {
+		t.Fatal(e)
+	}
+	leaf, e := x509.ParseCertificate(der)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}
+}
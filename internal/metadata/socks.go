@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	net_url "net/url"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// socksDialer dials through a socks proxy, the target host is resolved locally unless the scheme is socks5h or socks4a
+type socksDialer struct {
+	scheme string
+	// address of the proxy
+	address string
+	user    string
+	socks5  proxy.ContextDialer
+	// dials the proxy
+	forward *net.Dialer
+}
+
+func newSocksDialer(p *net_url.URL, forward *net.Dialer) (d *socksDialer, e error) {
+	address := p.Host
+	if p.Port() == `` {
+		address = net.JoinHostPort(p.Hostname(), `1080`)
+	}
+	d = &socksDialer{
+		scheme:  p.Scheme,
+		address: address,
+		forward: forward,
+	}
+	switch p.Scheme {
+	case `socks5`, `socks5h`:
+		var auth *proxy.Auth
+		if p.User != nil {
+			password, _ := p.User.Password()
+			auth = &proxy.Auth{
+				User:     p.User.Username(),
+				Password: password,
+			}
+		}
+		var dialer proxy.Dialer
+		dialer, e = proxy.SOCKS5(`tcp`, address, auth, forward)
+		if e != nil {
+			return
+		}
+		d.socks5 = dialer.(proxy.ContextDialer)
+	case `socks4`, `socks4a`:
+		if p.User != nil {
+			d.user = p.User.Username()
+		}
+	default:
+		e = fmt.Errorf(`not supported socks scheme: %v`, p.Scheme)
+	}
+	return
+}
+func (d *socksDialer) DialContext(ctx context.Context, network, addr string) (c net.Conn, e error) {
+	host, port, e := net.SplitHostPort(addr)
+	if e != nil {
+		return
+	}
+	if d.scheme == `socks5h` || d.scheme == `socks4a` || net.ParseIP(host) != nil {
+		return d.dial(ctx, network, host, port)
+	}
+	addrs, e := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if e != nil {
+		return
+	}
+	found := false
+	for _, ip := range addrs {
+		if d.scheme == `socks4` && ip.IP.To4() == nil {
+			continue
+		}
+		found = true
+		c, e = d.dial(ctx, network, ip.IP.String(), port)
+		if e == nil {
+			return
+		}
+	}
+	if !found {
+		e = fmt.Errorf(`no ipv4 address of %s for socks4`, host)
+	}
+	return
+}
+func (d *socksDialer) dial(ctx context.Context, network, host, port string) (net.Conn, error) {
+	if d.socks5 != nil {
+		return d.socks5.DialContext(ctx, network, net.JoinHostPort(host, port))
+	}
+	return d.dialSocks4(ctx, host, port)
+}
+
+// dialSocks4 sends the CONNECT request of socks4, socks4a sends the host name if it is not an ip
+func (d *socksDialer) dialSocks4(ctx context.Context, host, port string) (c net.Conn, e error) {
+	portNum, e := strconv.ParseUint(port, 10, 16)
+	if e != nil {
+		return
+	}
+	c, e = d.forward.DialContext(ctx, `tcp`, d.address)
+	if e != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	} else {
+		c.SetDeadline(time.Now().Add(time.Second * 30))
+	}
+	b := make([]byte, 8, 8+len(d.user)+1+len(host)+1)
+	b[0] = 4
+	b[1] = 1
+	binary.BigEndian.PutUint16(b[2:], uint16(portNum))
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		copy(b[4:], ip)
+		host = ``
+	} else if d.scheme == `socks4` {
+		c.Close()
+		c = nil
+		e = fmt.Errorf(`socks4 only supported ipv4, not supported %s`, host)
+		return
+	} else {
+		// 0.0.0.x tells the proxy to resolve the host name
+		b[7] = 1
+	}
+	b = append(b, d.user...)
+	b = append(b, 0)
+	if host != `` {
+		b = append(b, host...)
+		b = append(b, 0)
+	}
+	_, e = c.Write(b)
+	if e == nil {
+		_, e = io.ReadFull(c, b[:8])
+	}
+	if e == nil && b[1] != 0x5a {
+		e = errors.New(`socks4 proxy rejected the request: ` + strconv.Itoa(int(b[1])))
+	}
+	if e != nil {
+		c.Close()
+		c = nil
+		return
+	}
+	c.SetDeadline(time.Time{})
+	return
+}
@@ -8,8 +8,10 @@ const (
 	StatusNil Status = iota
 	StatusInit
 	StatusDownload
+	StatusPaused
 	StatusError
 	StatusMerge
+	StatusVerify
 	StatusSuccess
 )
 
@@ -21,10 +23,14 @@ func (s Status) String() string {
 		return `Init`
 	case StatusDownload:
 		return `Download`
+	case StatusPaused:
+		return `Paused`
 	case StatusError:
 		return `Error`
 	case StatusMerge:
 		return `Merge`
+	case StatusVerify:
+		return `Verify`
 	case StatusSuccess:
 		return `Success`
 	}
@@ -0,0 +1,170 @@
+package metadata
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLS is the tls options of the connections to the servers
+type TLS struct {
+	// pem file of the CA certificates used instead of the system CAs
+	CACert string
+	// pem files of the client certificate and key for mutual tls
+	Cert string
+	Key  string
+	// min tls version 1.0 1.1 1.2 or 1.3
+	MinVersion string
+	// server name sent in SNI and verified instead of the host of the primary url, mirrors and redirects use their own host
+	ServerName string
+	// sha256 of the SubjectPublicKeyInfo of the server certificate, sha256//base64 like curl
+	Pin []string
+	// pem file of the CA certificates used to verify the https proxies instead of the system CAs
+	ProxyCACert string
+	// allow insecure connections to the https proxies
+	ProxyInsecure bool
+}
+
+var tlsVersions = map[string]uint16{
+	`1.0`: tls.VersionTLS10,
+	`1.1`: tls.VersionTLS11,
+	`1.2`: tls.VersionTLS12,
+	`1.3`: tls.VersionTLS13,
+}
+
+func (t *TLS) IsZero() bool {
+	return t.isServerZero() && t.ProxyCACert == `` && !t.ProxyInsecure
+}
+func (t *TLS) isServerZero() bool {
+	return t.CACert == `` && t.Cert == `` && t.Key == `` && t.MinVersion == `` && t.ServerName == `` && len(t.Pin) == 0
+}
+
+// Check returns an error if the options are not valid
+func (t *TLS) Check() (e error) {
+	_, e = t.Config(false)
+	if e != nil {
+		return
+	}
+	_, e = t.ProxyConfig()
+	return
+}
+
+// Config returns the tls config of the servers, nil if no option is set
+func (t *TLS) Config(insecure bool) (c *tls.Config, e error) {
+	if !insecure && t.isServerZero() {
+		return
+	}
+	c = &tls.Config{
+		InsecureSkipVerify: insecure,
+		ServerName:         t.ServerName,
+	}
+	if t.CACert != `` {
+		c.RootCAs, e = loadCACert(t.CACert)
+		if e != nil {
+			return
+		}
+	}
+	if t.Cert != `` || t.Key != `` {
+		key := t.Key
+		if key == `` {
+			// the key is in the same file
+			key = t.Cert
+		}
+		var cert tls.Certificate
+		cert, e = tls.LoadX509KeyPair(t.Cert, key)
+		if e != nil {
+			return
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	if t.MinVersion != `` {
+		version, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			e = fmt.Errorf(`tls min version only supported 1.0 1.1 1.2 or 1.3, not supported %s`, t.MinVersion)
+			return
+		}
+		c.MinVersion = version
+	}
+	if len(t.Pin) != 0 {
+		pins := make(map[string]bool, len(t.Pin))
+		for _, pin := range t.Pin {
+			for _, str := range strings.Split(pin, `;`) {
+				str = strings.TrimSpace(str)
+				if !strings.HasPrefix(str, `sha256//`) {
+					e = fmt.Errorf(`pin only supported sha256//base64, not supported %s`, str)
+					return
+				}
+				pins[strings.TrimPrefix(str, `sha256//`)] = true
+			}
+		}
+		c.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New(`no certificate of the server to match the pin`)
+			}
+			sum := sha256.Sum256(cs.PeerCertificates[0].RawSubjectPublicKeyInfo)
+			if !pins[base64.StdEncoding.EncodeToString(sum[:])] {
+				return fmt.Errorf(`public key of %s does not match the pin`, cs.PeerCertificates[0].Subject)
+			}
+			return nil
+		}
+	}
+	return
+}
+
+// ProxyConfig returns the tls config of the https proxies, nil if no option is set
+func (t *TLS) ProxyConfig() (c *tls.Config, e error) {
+	if t.ProxyCACert == `` && !t.ProxyInsecure {
+		return
+	}
+	c = &tls.Config{
+		InsecureSkipVerify: t.ProxyInsecure,
+	}
+	if t.ProxyCACert != `` {
+		c.RootCAs, e = loadCACert(t.ProxyCACert)
+	}
+	return
+}
+func loadCACert(filename string) (pool *x509.CertPool, e error) {
+	b, e := os.ReadFile(filename)
+	if e != nil {
+		return
+	}
+	pool = x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		e = fmt.Errorf(`no certificate found in cacert: %s`, filename)
+	}
+	return
+}
+func (t *TLS) String() string {
+	strs := make([]string, 0, 8)
+	if t.CACert != `` {
+		strs = append(strs, `cacert=`+t.CACert)
+	}
+	if t.Cert != `` {
+		strs = append(strs, `cert=`+t.Cert)
+	}
+	if t.Key != `` {
+		strs = append(strs, `key=`+t.Key)
+	}
+	if t.MinVersion != `` {
+		strs = append(strs, `min=`+t.MinVersion)
+	}
+	if t.ServerName != `` {
+		strs = append(strs, `sni=`+t.ServerName)
+	}
+	if len(t.Pin) != 0 {
+		strs = append(strs, `pin=`+strings.Join(t.Pin, `;`))
+	}
+	if t.ProxyCACert != `` {
+		strs = append(strs, `proxy-cacert=`+t.ProxyCACert)
+	}
+	if t.ProxyInsecure {
+		strs = append(strs, `proxy-insecure`)
+	}
+	return strings.Join(strs, ` `)
+}
@@ -0,0 +1,62 @@
+package metadata
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServerName(t *testing.T) {
+	var (
+		m     sync.Mutex
+		names = make(map[string]string)
+	)
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		names[r.URL.Path] = r.TLS.ServerName
+		m.Unlock()
+		if r.URL.Path == `/redirect` {
+			http.Redirect(w, r, strings.Replace(`https://`+r.Host, `127.0.0.1`, `localhost`, 1)+`/target`, http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	options := TLS{ServerName: `origin.test`}
+	// the certificate of the server is not signed for origin.test
+	config, e := options.Config(true)
+	if e != nil {
+		t.Fatal(e)
+	}
+	client := &http.Client{
+		Transport: newProxyTransport(&Proxies{}, config, nil, `127.0.0.1`, DefaultTransport()),
+	}
+	mirror := strings.Replace(srv.URL, `127.0.0.1`, `localhost`, 1)
+	for _, url := range []string{srv.URL + `/primary`, mirror + `/mirror`, srv.URL + `/redirect`} {
+		resp, e := client.Get(url)
+		if e != nil {
+			t.Fatal(e)
+		}
+		resp.Body.Close()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	tests := []struct {
+		path string
+		name string
+	}{
+		{`/primary`, `origin.test`},
+		{`/mirror`, `localhost`},
+		{`/redirect`, `origin.test`},
+		{`/target`, `localhost`},
+	}
+	for _, test := range tests {
+		if name, ok := names[test.path]; !ok {
+			t.Errorf(`%s: not requested`, test.path)
+		} else if name != test.name {
+			t.Errorf(`%s: expected sni %q got %q`, test.path, test.name, name)
+		}
+	}
+}
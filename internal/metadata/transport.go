@@ -0,0 +1,56 @@
+package metadata
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Transport is the options of the http connections, a zero duration is no timeout
+type Transport struct {
+	ConnectTimeout        time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// idle connections kept for reuse, less than 1 keeps a connection of every worker
+	MaxIdleConnsPerHost int
+	// allow HTTP/2, the workers share one connection by multiplexing instead of a connection of every worker
+	HTTP2 bool
+}
+
+// DefaultTransport returns the default options
+func DefaultTransport() Transport {
+	return Transport{
+		ConnectTimeout:        time.Second * 30,
+		TLSHandshakeTimeout:   time.Second * 10,
+		ResponseHeaderTimeout: time.Second * 30,
+		MaxIdleConnsPerHost:   MaxWorkers,
+	}
+}
+func (t *Transport) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:   t.ConnectTimeout,
+		KeepAlive: time.Second * 30,
+	}
+}
+func (t *Transport) newTransport(dialer *net.Dialer) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = t.TLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = t.ResponseHeaderTimeout
+	if t.MaxIdleConnsPerHost < 1 {
+		transport.MaxIdleConnsPerHost = MaxWorkers
+	} else {
+		transport.MaxIdleConnsPerHost = t.MaxIdleConnsPerHost
+	}
+	if transport.MaxIdleConns < transport.MaxIdleConnsPerHost {
+		transport.MaxIdleConns = transport.MaxIdleConnsPerHost
+	}
+	if !t.HTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		// a non-nil empty map disables HTTP/2
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket limiting the bytes per second, rate 0 or a nil *Limiter does not limit
+type Limiter struct {
+	m      sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate int64) *Limiter {
+	if rate < 0 {
+		rate = 0
+	}
+	return &Limiter{
+		rate: rate,
+	}
+}
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.m.Lock()
+	rate := l.rate
+	l.m.Unlock()
+	return rate
+}
+func (l *Limiter) SetRate(rate int64) {
+	if rate < 0 {
+		rate = 0
+	}
+	l.m.Lock()
+	if l.rate != rate {
+		l.rate = rate
+		l.tokens = 0
+		l.last = time.Now()
+	}
+	l.m.Unlock()
+}
+
+// Wait blocks until n bytes are allowed, the bucket holds at most one second of tokens
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n < 1 {
+		return nil
+	}
+	l.m.Lock()
+	if l.rate == 0 {
+		l.m.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > float64(l.rate) {
+			l.tokens = float64(l.rate)
+		}
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.m.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		timer.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		limiter *Limiter
+		// waits of n bytes
+		waits int
+		n     int
+		min   time.Duration
+		max   time.Duration
+	}{
+		{nil, 10, int(M), 0, time.Millisecond * 50},
+		{NewLimiter(0), 10, int(M), 0, time.Millisecond * 50},
+		{NewLimiter(-1), 10, int(M), 0, time.Millisecond * 50},
+		// the bucket starts empty
+		{NewLimiter(int64(M) * 8), 4, int(M), time.Millisecond * 450, time.Millisecond * 800},
+		{NewLimiter(int64(M) * 10), 100, int(K) * 25, time.Millisecond * 200, time.Millisecond * 500},
+	}
+	for i, test := range tests {
+		at := time.Now()
+		for j := 0; j < test.waits; j++ {
+			if e := test.limiter.Wait(context.Background(), test.n); e != nil {
+				t.Fatal(e)
+			}
+		}
+		if used := time.Since(at); used < test.min || used > test.max {
+			t.Errorf(`%v: expected [%v, %v] got %v`, i, test.min, test.max, used)
+		}
+	}
+
+	l := NewLimiter(int64(M) * 8)
+	l.SetRate(int64(K))
+	if l.Rate() != int64(K) {
+		t.Errorf(`expected rate %v got %v`, K, l.Rate())
+	}
+	// the wait is canceled by the context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	if e := l.Wait(ctx, int(M)); e != context.DeadlineExceeded {
+		t.Errorf(`expected %v got %v`, context.DeadlineExceeded, e)
+	}
+}